@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/backup"
+	"github.com/EgorBessonov/CRUDServer/internal/config"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultImagesDir = "images"
+)
+
+// runBackup writes all data of CurrentDB repository and images directory
+// into archive selected by -out flag
+func runBackup(cfg configs.Config, args []string) (err error) {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	out := flags.String("out", "crudserver-"+time.Now().UTC().Format("20060102-150405")+".tar.gz", "archive file")
+	imagesDir := flags.String("images", defaultImagesDir, "images directory")
+	batchSize := flags.Int("batch", defaultBatchSize, "entities read per batch")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	ctx, cancel := context.WithCancel(tenant.AllTenants(context.Background()))
+	defer cancel()
+	rps, _, err := dbConnection(ctx, cfg, cfg.CurrentDB)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s database - %w", cfg.CurrentDB, err)
+	}
+	defer func() {
+		if err := rps.CloseDBConnection(); err != nil {
+			log.Errorf("error while closing repository - %e", err)
+		}
+	}()
+
+	tmpPath := *out + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("can't create archive - %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+	manifest, err := backup.Backup(ctx, rps, cfg.CurrentDB, *imagesDir, *batchSize, f)
+	if err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("can't write archive - %w", err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("can't write archive - %w", err)
+	}
+	if err = os.Rename(tmpPath, *out); err != nil {
+		return fmt.Errorf("can't write archive - %w", err)
+	}
+	log.WithFields(log.Fields{
+		"archive": *out,
+		"entries": len(manifest.Entries),
+	}).Info("backup created")
+	return nil
+}
+
+// runRestore writes content of archive selected by -in flag into
+// repository selected by -to flag and images directory
+func runRestore(cfg configs.Config, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := flags.String("in", "", "archive file")
+	to := flags.String("to", cfg.CurrentDB, "target database: postgres, mongo, sqlite or memory")
+	imagesDir := flags.String("images", defaultImagesDir, "images directory")
+	verifyOnly := flags.Bool("verify-only", false, "only check archive version and checksums")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *in == "" {
+		return fmt.Errorf("archive must be set with -in")
+	}
+	if *verifyOnly {
+		manifest, err := backup.Verify(*in)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"source":    manifest.Source,
+			"createdAt": manifest.CreatedAt,
+			"entries":   len(manifest.Entries),
+		}).Info("backup verified")
+		return nil
+	}
+	ctx, cancel := context.WithCancel(tenant.AllTenants(context.Background()))
+	defer cancel()
+	rps, _, err := dbConnection(ctx, cfg, *to)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s database - %w", *to, err)
+	}
+	defer func() {
+		if err := rps.CloseDBConnection(); err != nil {
+			log.Errorf("error while closing repository - %e", err)
+		}
+	}()
+	manifest, err := backup.Restore(ctx, rps, *imagesDir, *in)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"source":    manifest.Source,
+		"target":    *to,
+		"createdAt": manifest.CreatedAt,
+	}).Info("backup restored")
+	return nil
+}
@@ -0,0 +1,458 @@
+// Package backup writes all server data into single archive and restores
+// it into any repository implementation
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FormatVersion is version of archive layout written by Backup. Restore
+// rejects archives of other versions
+const FormatVersion = 1
+
+const (
+	manifestName  = "manifest.json"
+	tenantsName   = "tenants.jsonl"
+	ordersName    = "orders.jsonl"
+	archivedName  = "archived_orders.jsonl"
+	authUsersName = "authusers.jsonl"
+	imagesPrefix  = "images/"
+	fileMode      = 0o644
+)
+
+// Manifest type describes archive content. It is written as the last
+// archive entry
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Source    string    `json:"source"`
+	Entries   []Entry   `json:"entries"`
+}
+
+// Entry type describes one archive file. Count is number of entities in
+// jsonl entries and zero for images
+type Entry struct {
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup writes tenants, orders, archived orders, auth users and content
+// of imagesDir into w as gzip compressed tar archive. Missing imagesDir is
+// treated as empty
+func Backup(ctx context.Context, rps repository.Repository, source, imagesDir string, batchSize int, w io.Writer) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC(), Source: source}
+
+	dumps := []struct {
+		name string
+		dump func(context.Context, repository.Repository, int, *json.Encoder) (int, error)
+	}{
+		{tenantsName, dumpTenants},
+		{ordersName, dumpOrders},
+		{archivedName, dumpArchivedOrders},
+		{authUsersName, dumpAuthUsers},
+	}
+	for _, d := range dumps {
+		entry, err := writeDump(tw, d.name, func(enc *json.Encoder) (int, error) {
+			return d.dump(ctx, rps, batchSize, enc)
+		})
+		if err != nil {
+			return nil, err
+		}
+		manifest.Entries = append(manifest.Entries, *entry)
+	}
+	images, err := writeImages(tw, imagesDir)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Entries = append(manifest.Entries, images...)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("backup: can't encode manifest - %w", err)
+	}
+	if err := tw.WriteHeader(fileHeader(manifestName, int64(len(data)))); err != nil {
+		return nil, fmt.Errorf("backup: can't write manifest - %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, fmt.Errorf("backup: can't write manifest - %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("backup: can't close archive - %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("backup: can't close archive - %w", err)
+	}
+	return manifest, nil
+}
+
+// writeDump encodes entities into temporary file first, because tar header
+// needs entry size before content
+func writeDump(tw *tar.Writer, name string, dump func(*json.Encoder) (int, error)) (*Entry, error) {
+	tmp, err := os.CreateTemp("", "crudserver-backup-*")
+	if err != nil {
+		return nil, fmt.Errorf("backup: can't create temporary file - %w", err)
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	bw := bufio.NewWriter(tmp)
+	count, err := dump(json.NewEncoder(bw))
+	if err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, fmt.Errorf("backup: can't write %s - %w", name, err)
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("backup: can't write %s - %w", name, err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("backup: can't write %s - %w", name, err)
+	}
+	sum, err := writeEntry(tw, name, size, tmp)
+	if err != nil {
+		return nil, err
+	}
+	log.WithFields(log.Fields{
+		"entry": name,
+		"count": count,
+	}).Info("backup: entities written")
+	return &Entry{Name: name, Count: count, Size: size, SHA256: sum}, nil
+}
+
+func writeImages(tw *tar.Writer, imagesDir string) ([]Entry, error) {
+	var entries []Entry
+	err := filepath.WalkDir(imagesDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && p == imagesDir {
+				return fs.SkipDir
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(imagesDir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+		name := imagesPrefix + filepath.ToSlash(rel)
+		sum, err := writeEntry(tw, name, info.Size(), f)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Name: name, Size: info.Size(), SHA256: sum})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("backup: can't write images - %w", err)
+	}
+	return entries, nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) (string, error) {
+	if err := tw.WriteHeader(fileHeader(name, size)); err != nil {
+		return "", fmt.Errorf("backup: can't write %s - %w", name, err)
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(tw, h), r, size); err != nil {
+		return "", fmt.Errorf("backup: can't write %s - %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileHeader(name string, size int64) *tar.Header {
+	return &tar.Header{
+		Name:    name,
+		Mode:    fileMode,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+}
+
+func dumpTenants(ctx context.Context, rps repository.Repository, batchSize int, enc *json.Encoder) (int, error) {
+	count := 0
+	afterID := ""
+	for {
+		tenants, err := rps.GetTenants(ctx, afterID, batchSize)
+		if err != nil {
+			return 0, fmt.Errorf("backup: can't read tenants - %w", err)
+		}
+		for _, t := range tenants {
+			if err := enc.Encode(t); err != nil {
+				return 0, fmt.Errorf("backup: can't encode tenant - %w", err)
+			}
+			afterID = t.TenantID
+		}
+		count += len(tenants)
+		if len(tenants) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+func dumpOrders(ctx context.Context, rps repository.Repository, batchSize int, enc *json.Encoder) (int, error) {
+	return dumpOrderPages(ctx, rps.GetOrders, batchSize, enc)
+}
+
+func dumpArchivedOrders(ctx context.Context, rps repository.Repository, batchSize int, enc *json.Encoder) (int, error) {
+	return dumpOrderPages(ctx, rps.GetArchivedOrders, batchSize, enc)
+}
+
+func dumpOrderPages(ctx context.Context, page func(context.Context, string, int) ([]*model.Order, error),
+	batchSize int, enc *json.Encoder) (int, error) {
+	count := 0
+	afterID := ""
+	for {
+		orders, err := page(ctx, afterID, batchSize)
+		if err != nil {
+			return 0, fmt.Errorf("backup: can't read orders - %w", err)
+		}
+		for _, order := range orders {
+			if err := enc.Encode(order); err != nil {
+				return 0, fmt.Errorf("backup: can't encode order - %w", err)
+			}
+			afterID = order.OrderID
+		}
+		count += len(orders)
+		if len(orders) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+func dumpAuthUsers(ctx context.Context, rps repository.Repository, batchSize int, enc *json.Encoder) (int, error) {
+	count := 0
+	afterID := ""
+	for {
+		authUsers, err := rps.GetAuthUsers(ctx, afterID, batchSize)
+		if err != nil {
+			return 0, fmt.Errorf("backup: can't read authUsers - %w", err)
+		}
+		for _, authUser := range authUsers {
+			if err := enc.Encode(authUser); err != nil {
+				return 0, fmt.Errorf("backup: can't encode authUser - %w", err)
+			}
+			afterID = authUser.UserUUID
+		}
+		count += len(authUsers)
+		if len(authUsers) < batchSize {
+			return count, nil
+		}
+	}
+}
+
+// Verify reads archive at archivePath and checks its version and checksum
+// of every entry listed in manifest
+func Verify(archivePath string) (*Manifest, error) {
+	sums := make(map[string]Entry)
+	var manifest *Manifest
+	err := readArchive(archivePath, func(hdr *tar.Header, r io.Reader) error {
+		if hdr.Name == manifestName {
+			manifest = &Manifest{}
+			if err := json.NewDecoder(r).Decode(manifest); err != nil {
+				return fmt.Errorf("can't parse manifest - %w", err)
+			}
+			return nil
+		}
+		h := sha256.New()
+		size, err := io.Copy(h, r)
+		if err != nil {
+			return err
+		}
+		sums[hdr.Name] = Entry{Name: hdr.Name, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("backup: archive has no manifest")
+	}
+	if manifest.Version != FormatVersion {
+		return nil, fmt.Errorf("backup: unsupported archive version %d, expected %d", manifest.Version, FormatVersion)
+	}
+	for _, entry := range manifest.Entries {
+		got, ok := sums[entry.Name]
+		if !ok {
+			return nil, fmt.Errorf("backup: entry %s is missing in archive", entry.Name)
+		}
+		if got.Size != entry.Size || got.SHA256 != entry.SHA256 {
+			return nil, fmt.Errorf("backup: entry %s checksum mismatch", entry.Name)
+		}
+		delete(sums, entry.Name)
+	}
+	for name := range sums {
+		return nil, fmt.Errorf("backup: entry %s isn't listed in manifest", name)
+	}
+	return manifest, nil
+}
+
+// Restore verifies archive at archivePath and then writes its content into
+// rps and imagesDir. Entities which already exist are overwritten, so
+// restore can be safely repeated
+func Restore(ctx context.Context, rps repository.Repository, imagesDir, archivePath string) (*Manifest, error) {
+	manifest, err := Verify(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	err = readArchive(archivePath, func(hdr *tar.Header, r io.Reader) error {
+		switch {
+		case hdr.Name == tenantsName:
+			return restoreLines(r, func(dec *json.Decoder) error { return restoreTenant(ctx, rps, dec) })
+		case hdr.Name == ordersName:
+			return restoreLines(r, func(dec *json.Decoder) error { return restoreOrder(ctx, rps, dec) })
+		case hdr.Name == archivedName:
+			return restoreLines(r, func(dec *json.Decoder) error { return restoreArchivedOrder(ctx, rps, dec) })
+		case hdr.Name == authUsersName:
+			return restoreLines(r, func(dec *json.Decoder) error { return restoreAuthUser(ctx, rps, dec) })
+		case strings.HasPrefix(hdr.Name, imagesPrefix):
+			return restoreImage(imagesDir, strings.TrimPrefix(hdr.Name, imagesPrefix), r)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func restoreTenant(ctx context.Context, rps repository.Repository, dec *json.Decoder) error {
+	var t model.Tenant
+	if err := dec.Decode(&t); err != nil {
+		return err
+	}
+	err := rps.SaveTenant(ctx, &t)
+	if errors.Is(err, repository.ErrConflict) {
+		err = rps.UpdateTenant(ctx, &t)
+	}
+	return err
+}
+
+func restoreOrder(ctx context.Context, rps repository.Repository, dec *json.Decoder) error {
+	var order model.Order
+	if err := dec.Decode(&order); err != nil {
+		return err
+	}
+	err := rps.Save(ctx, &order)
+	if errors.Is(err, repository.ErrConflict) {
+		err = rps.Update(ctx, &order)
+	}
+	return err
+}
+
+func restoreArchivedOrder(ctx context.Context, rps repository.Repository, dec *json.Decoder) error {
+	var order model.Order
+	if err := dec.Decode(&order); err != nil {
+		return err
+	}
+	return rps.SaveArchivedOrder(ctx, &order)
+}
+
+func restoreAuthUser(ctx context.Context, rps repository.Repository, dec *json.Decoder) error {
+	var authUser model.AuthUser
+	if err := dec.Decode(&authUser); err != nil {
+		return err
+	}
+	if err := rps.SaveAuthUser(ctx, &authUser); err != nil && !errors.Is(err, repository.ErrConflict) {
+		return err
+	}
+	return rps.UpdateAuthUser(ctx, authUser.Email, authUser.RefreshToken)
+}
+
+func restoreImage(imagesDir, name string, r io.Reader) error {
+	clean := path.Clean(name)
+	if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("invalid image path %q", name)
+	}
+	dst := filepath.Join(imagesDir, filepath.FromSlash(clean))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileMode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restoreLines calls fn for every json value of r
+func restoreLines(r io.Reader, fn func(*json.Decoder) error) error {
+	dec := json.NewDecoder(r)
+	for dec.More() {
+		if err := fn(dec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readArchive(archivePath string, fn func(*tar.Header, io.Reader) error) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("backup: can't open archive - %w", err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("backup: can't read archive - %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("backup: can't read archive - %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return fmt.Errorf("backup: can't process %s - %w", hdr.Name, err)
+		}
+	}
+}
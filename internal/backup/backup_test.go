@@ -0,0 +1,193 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newRepository(t *testing.T) repository.Repository {
+	rps, err := repository.NewMemoryRepository("")
+	if err != nil {
+		t.Fatalf("can't create memory repository - %v", err)
+	}
+	return rps
+}
+
+// writeBackup seeds repository and images directory and backs them up into
+// archive inside temporary directory
+func writeBackup(t *testing.T) string {
+	ctx := tenant.AllTenants(context.Background())
+	rps := newRepository(t)
+	if err := rps.SaveTenant(ctx, &model.Tenant{TenantID: "acme", Name: "Acme"}); err != nil {
+		t.Fatalf("SaveTenant failed - %v", err)
+	}
+	if err := rps.Save(ctx, &model.Order{OrderID: "live", OrderName: "live order", OrderCost: 10, TenantID: "acme"}); err != nil {
+		t.Fatalf("Save failed - %v", err)
+	}
+	if err := rps.SaveArchivedOrder(ctx, &model.Order{OrderID: "old", OrderName: "old order", IsDelivered: true, DeliveredAt: 100, TenantID: "acme"}); err != nil {
+		t.Fatalf("SaveArchivedOrder failed - %v", err)
+	}
+	if err := rps.SaveAuthUser(ctx, &model.AuthUser{Email: "user@acme.io", Password: "hash", RefreshToken: "token", TenantID: "acme"}); err != nil {
+		t.Fatalf("SaveAuthUser failed - %v", err)
+	}
+	dir := t.TempDir()
+	imagesDir := filepath.Join(dir, "images")
+	if err := os.MkdirAll(filepath.Join(imagesDir, "orders"), 0o755); err != nil {
+		t.Fatalf("can't create images dir - %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(imagesDir, "orders", "live.png"), []byte("image"), fileMode); err != nil {
+		t.Fatalf("can't write image - %v", err)
+	}
+	archivePath := filepath.Join(dir, "backup.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("can't create archive - %v", err)
+	}
+	defer f.Close()
+	if _, err := Backup(ctx, rps, "memory", imagesDir, 1, f); err != nil {
+		t.Fatalf("Backup failed - %v", err)
+	}
+	return archivePath
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	ctx := tenant.AllTenants(context.Background())
+	archivePath := writeBackup(t)
+	manifest, err := Verify(archivePath)
+	if err != nil {
+		t.Fatalf("Verify failed - %v", err)
+	}
+	counts := make(map[string]int)
+	for _, entry := range manifest.Entries {
+		counts[entry.Name] = entry.Count
+	}
+	if counts[ordersName] != 1 || counts[archivedName] != 1 || counts[authUsersName] != 1 {
+		t.Errorf("manifest counts %v, want one order, archived order and authUser", counts)
+	}
+
+	rps := newRepository(t)
+	imagesDir := filepath.Join(t.TempDir(), "images")
+	// restore is repeated to check that existing entities are overwritten
+	for i := 0; i < 2; i++ {
+		if _, err := Restore(ctx, rps, imagesDir, archivePath); err != nil {
+			t.Fatalf("Restore #%d failed - %v", i+1, err)
+		}
+	}
+	if got, err := rps.GetTenant(ctx, "acme"); err != nil || got.Name != "Acme" {
+		t.Errorf("restored tenant %+v, %v, want Acme", got, err)
+	}
+	scoped := tenant.WithID(context.Background(), "acme")
+	if got, err := rps.Get(scoped, "live"); err != nil || got.OrderName != "live order" || got.OrderCost != 10 {
+		t.Errorf("restored order %+v, %v, want live order", got, err)
+	}
+	if got, err := rps.GetArchivedOrder(scoped, "old"); err != nil || got.OrderName != "old order" {
+		t.Errorf("restored archived order %+v, %v, want old order", got, err)
+	}
+	if got, err := rps.GetAuthUser(ctx, "user@acme.io"); err != nil || got.RefreshToken != "token" || got.TenantID != "acme" {
+		t.Errorf("restored authUser %+v, %v, want user of acme", got, err)
+	}
+	if data, err := os.ReadFile(filepath.Join(imagesDir, "orders", "live.png")); err != nil || string(data) != "image" {
+		t.Errorf("restored image %q, %v, want %q", data, err, "image")
+	}
+}
+
+func TestVerifyRejectsBrokenArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		wantErr string
+	}{
+		{"no manifest", []archiveEntry{{ordersName, "{}\n"}}, "no manifest"},
+		{"unsupported version", []archiveEntry{manifestEntry(t, FormatVersion+1)}, "unsupported archive version"},
+		{"entry not in manifest", []archiveEntry{{ordersName, "{}\n"}, manifestEntry(t, FormatVersion)}, "isn't listed in manifest"},
+		{"entry missing in archive", []archiveEntry{manifestEntry(t, FormatVersion, archiveEntry{ordersName, "{}\n"})}, "is missing in archive"},
+		{"checksum mismatch", []archiveEntry{{ordersName, "[]\n"}, manifestEntry(t, FormatVersion, archiveEntry{ordersName, "{}\n"})}, "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Verify(writeArchive(t, tt.entries))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify returned %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsImagePathTraversal(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+	}{
+		{"parent directory", imagesPrefix + "../evil.png"},
+		{"nested parent directory", imagesPrefix + "orders/../../evil.png"},
+		{"absolute path", imagesPrefix + "/evil.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			image := archiveEntry{tt.image, "image"}
+			archivePath := writeArchive(t, []archiveEntry{image, manifestEntry(t, FormatVersion, image)})
+			imagesDir := filepath.Join(t.TempDir(), "images")
+			_, err := Restore(tenant.AllTenants(context.Background()), newRepository(t), imagesDir, archivePath)
+			if err == nil || !strings.Contains(err.Error(), "invalid image path") {
+				t.Errorf("Restore returned %v, want invalid image path error", err)
+			}
+			if _, err := os.Stat(filepath.Join(filepath.Dir(imagesDir), "evil.png")); !os.IsNotExist(err) {
+				t.Errorf("image was written outside images dir")
+			}
+		})
+	}
+}
+
+type archiveEntry struct {
+	name    string
+	content string
+}
+
+// manifestEntry returns manifest of version which lists entries
+func manifestEntry(t *testing.T, version int, entries ...archiveEntry) archiveEntry {
+	manifest := Manifest{Version: version}
+	for _, e := range entries {
+		sum := sha256.Sum256([]byte(e.content))
+		manifest.Entries = append(manifest.Entries, Entry{Name: e.name, Size: int64(len(e.content)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("can't encode manifest - %v", err)
+	}
+	return archiveEntry{manifestName, string(data)}
+}
+
+// writeArchive writes entries into gzip compressed tar archive as is
+func writeArchive(t *testing.T, entries []archiveEntry) string {
+	archivePath := filepath.Join(t.TempDir(), "backup.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("can't create archive - %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if _, err := writeEntry(tw, e.name, int64(len(e.content)), strings.NewReader(e.content)); err != nil {
+			t.Fatalf("can't write %s - %v", e.name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("can't close archive - %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("can't close archive - %v", err)
+	}
+	return archivePath
+}
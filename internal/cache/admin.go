@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis"
+)
+
+// Stats type describes cache content and stream consumer position
+type Stats struct {
+	Store           string        `json:"store"`
+	Sources         []string      `json:"sources"`
+	Entries         int           `json:"entries"`
+	NegativeEntries int           `json:"negativeEntries"`
+	Ready           bool          `json:"ready"`
+	Healthy         bool          `json:"healthy"`
+	Buffered        int           `json:"buffered"`
+	DeadLetters     int64         `json:"deadLetters"`
+	Group           string        `json:"group,omitempty"`
+	Consumer        string        `json:"consumer,omitempty"`
+	Streams         []StreamStats `json:"streams,omitempty"`
+}
+
+// StreamStats type describes consumer position in stream of one tenant
+type StreamStats struct {
+	TenantID string `json:"tenantID"`
+	Stream   string `json:"stream"`
+	LastID   string `json:"lastID"`
+	Length   int64  `json:"length"`
+	Pending  int64  `json:"pending"`
+}
+
+// Stats method returns cache size and position of consumer in every
+// registered tenant stream
+func (orderCache *OrderCache) Stats() (*Stats, error) {
+	entries, err := orderCache.orders.Size()
+	if err != nil && orderCache.Healthy() {
+		return nil, err
+	}
+	stats := &Stats{
+		Store:   orderCache.storeName,
+		Sources: orderCache.sources,
+		Entries: entries,
+		Ready:   orderCache.Ready(),
+		Healthy: orderCache.Healthy(),
+	}
+	orderCache.mutex.Lock()
+	stats.Buffered = len(orderCache.buffer)
+	if orderCache.missing != nil {
+		stats.NegativeEntries = orderCache.missing.len()
+	}
+	lastIDs := make(map[string]string, len(orderCache.lastIDs))
+	for tenantID, lastID := range orderCache.lastIDs {
+		lastIDs[tenantID] = lastID
+	}
+	orderCache.mutex.Unlock()
+	if !orderCache.useStream || !stats.Healthy {
+		return stats, nil
+	}
+	stats.Group, stats.Consumer = orderCache.group, orderCache.consumer
+	if stats.DeadLetters, err = orderCache.redisClient.XLen(orderCache.deadLetterStream()).Result(); err != nil {
+		return nil, fmt.Errorf("cache: can't read length of dead-letter stream - %w", err)
+	}
+	for tenantID, lastID := range lastIDs {
+		stream := orderCache.stream(tenantID)
+		length, err := orderCache.redisClient.XLen(stream).Result()
+		if err != nil {
+			return nil, fmt.Errorf("cache: can't read length of stream %s - %w", stream, err)
+		}
+		pending, err := orderCache.redisClient.XPending(stream, orderCache.group).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("cache: can't read pending messages of stream %s - %w", stream, err)
+		}
+		s := StreamStats{TenantID: tenantID, Stream: stream, LastID: lastID, Length: length}
+		if pending != nil {
+			s.Pending = pending.Count
+		}
+		stats.Streams = append(stats.Streams, s)
+	}
+	sort.Slice(stats.Streams, func(i, j int) bool { return stats.Streams[i].TenantID < stats.Streams[j].TenantID })
+	return stats, nil
+}
+
+// Invalidate method drops order of tenant from cache of every instance
+func (orderCache *OrderCache) Invalidate(tenantID, orderID string) error {
+	orderCache.metrics.invalidated("order")
+	orderCache.forgetMissing(tenantID, orderID)
+	return orderCache.Delete(tenantID, orderID)
+}
+
+// Flush method drops all orders cached by this instance. Shared store is
+// flushed for all instances
+func (orderCache *OrderCache) Flush() {
+	orderCache.invalidateAll()
+}
@@ -3,95 +3,299 @@ package cache
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	configs "github.com/EgorBessonov/CRUDServer/internal/config"
 	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/retry"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis"
 	log "github.com/sirupsen/logrus"
 )
 
-// OrderCache type represents cache object structure and behavior
+// pollInterval is how long stream reading blocks, so tenants registered
+// while reading are picked up on next read
+const pollInterval = time.Second
+
+// invalidation sources
+const (
+	sourceStream   = "stream"
+	sourcePostgres = "postgres"
+	sourceMongo    = "mongo"
+)
+
+// OrderCache type represents cache object structure and behavior. Every
+// tenant has its own redis stream and orders of one tenant are never
+// returned for another. Without stream source changes are applied to local
+// cache right away and other instances learn them from database. Streams
+// are read by consumer group, so messages published while instance was down
+// are applied after restart. Orders are kept in store which is local to
+// instance, shared through redis or both. Every change carries version, so
+// delayed change doesn't overwrite newer one
 type OrderCache struct {
-	orders      map[string]*model.Order
+	orders      Store
+	storeName   string
+	sources     []string
+	metrics     *Metrics
+	missing     *lru
+	lastIDs     map[string]string
+	backlog     map[string]bool
 	redisClient *redis.Client
 	streamName  string
-	mutex       sync.Mutex
+	maxLen      int64
+	// handlerPolicy is how failed stream messages are retried before they
+	// are moved to dead-letter stream
+	handlerPolicy    retry.Policy
+	deadLetterMaxLen int64
+	group            string
+	consumer         string
+	useStream        bool
+	ready            int32
+	healthy          int32
+	policy           string
+	bufferSize       int
+	buffer           []cacheEvent
+	version          int64
+	mutex            sync.Mutex
 }
 
-// NewCache returns new cache instance with redisdb client
-func NewCache(ctx context.Context, cfg configs.Config, rCli *redis.Client) *OrderCache {
+// NewCache returns new cache instance with redisdb client. Nil m disables
+// cache metrics
+func NewCache(ctx context.Context, cfg configs.Config, rCli *redis.Client, m *Metrics) (*OrderCache, error) {
 	var cache OrderCache
-	cache.orders = make(map[string]*model.Order)
+	orders, err := NewStore(ctx, cfg, rCli, m)
+	if err != nil {
+		return nil, err
+	}
+	cache.orders = orders
+	cache.storeName = cfg.CacheStore
+	cache.sources = cfg.CacheSources
+	cache.metrics = m
+	if cfg.CacheNegativeTTL > 0 {
+		cache.missing = newLRU(cfg.CacheNegativeMaxEntries, 0, cfg.CacheNegativeTTL)
+	}
+	cache.lastIDs = make(map[string]string)
+	cache.backlog = make(map[string]bool)
 	cache.redisClient = rCli
 	cache.streamName = cfg.StreamName
+	cache.maxLen = cfg.StreamMaxLen
+	cache.handlerPolicy = retry.Policy{
+		Attempts:       cfg.StreamHandlerAttempts,
+		InitialBackoff: cfg.StreamHandlerBackoff,
+		MaxBackoff:     cfg.StreamHandlerMaxBackoff,
+	}
+	cache.deadLetterMaxLen = cfg.StreamDeadLetterMaxLen
+	cache.group, cache.consumer = consumerNames(cfg)
+	cache.useStream = hasSource(cfg, sourceStream)
+	cache.policy = cfg.CacheDegradedPolicy
+	if cache.policy != policyDrop && cache.policy != policyBuffer {
+		return nil, fmt.Errorf("cache: unknown degraded policy %q", cache.policy)
+	}
+	cache.bufferSize = cfg.CacheBufferSize
+	cache.healthy = 1
+	if rCli != nil {
+		if err := rCli.Ping().Err(); err != nil {
+			cache.markUnhealthy(err)
+		}
+		go cache.monitorRedis(ctx, cfg.HealthCheckInterval)
+	}
+	m.observeHealth(&cache)
+	if !cache.useStream {
+		return &cache, nil
+	}
+	if cache.Healthy() {
+		if err := cache.claimGroup(); errors.Is(err, errGroupShared) {
+			return nil, err
+		} else if err != nil {
+			cache.markUnhealthy(err)
+		}
+	}
+	if cfg.StreamRetention > 0 && cfg.StreamRetentionInterval > 0 {
+		go cache.runRetention(ctx, cfg.StreamRetentionInterval, cfg.StreamRetention)
+	}
+	if cfg.StreamReclaimInterval > 0 {
+		go cache.reclaimPending(ctx, cfg.StreamReclaimInterval, cfg.StreamReclaimMinIdle)
+	}
 	go func() {
+		cache.registerCheckpointed()
+		var claimedAt time.Time
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
-				result, err := rCli.XRead(&redis.XReadArgs{
-					Streams: []string{cfg.StreamName, "$"},
-					Count:   1,
-					Block:   0,
-				}).Result()
-				if err != nil {
-					log.WithFields(log.Fields{
-						"status": "failed",
-						"err":    err,
-					}).Info("redis stream info")
+				if !cache.Healthy() {
+					sleep(ctx, pollInterval)
+					continue
 				}
-				bytes := result[0].Messages[0]
-				msg := bytes.Values
-				msgString, ok := msg["data"].(string)
-				if ok {
-					order := model.Order{}
-					err := json.Unmarshal([]byte(msgString), &order)
-					if err != nil {
-						fmt.Print(err)
+				if time.Since(claimedAt) >= groupLease/3 {
+					err := cache.claimGroup()
+					if errors.Is(err, errGroupShared) {
+						log.Errorf("cache: stream reading stopped - %e", err)
+						return
 					}
-					if err := cache.streamMessageHandler(msg["method"].(string), &order); err != nil {
-						log.Errorf("stream error - %e", err)
+					if err != nil {
+						cache.markUnhealthy(err)
+						continue
 					}
+					claimedAt = time.Now()
 				}
+				cache.readStreams(ctx)
 			}
 		}
 	}()
-	return &cache
+	return &cache, nil
 }
 
-// Get method return order instance from cache
-func (orderCache *OrderCache) Get(orderID string) (*model.Order, bool) {
-	orderCache.mutex.Lock()
-	defer orderCache.mutex.Unlock()
-	order, found := orderCache.orders[orderID]
+// Get method return order instance of tenant from cache
+func (orderCache *OrderCache) Get(tenantID, orderID string) (*model.Order, bool) {
+	if !orderCache.Healthy() {
+		orderCache.metrics.lookup(false)
+		return nil, false
+	}
+	if orderCache.useStream {
+		if err := orderCache.register(tenantID); err != nil {
+			log.Errorf("cache: can't register tenant stream - %e", err)
+		}
+	}
+	order, found, err := orderCache.orders.Get(tenantID, orderID)
+	if err != nil {
+		log.Errorf("cache: can't get order - %e", err)
+	}
+	orderCache.metrics.lookup(found)
 	return order, found
 }
 
-//Save method send message to redis stream for saving order
+// Save method send message to redis stream for saving order. UpdatedAt of
+// order is version of change
 func (orderCache *OrderCache) Save(order *model.Order) error {
-	return orderCache.sendMessageToStream("save", order)
+	return orderCache.sendMessageToStream(order.TenantID, "save", order, order.UpdatedAt)
 }
 
-// Update method send message to redis stream for updating order
+// Update method send message to redis stream for updating order. UpdatedAt
+// of order is version of change
 func (orderCache *OrderCache) Update(order *model.Order) error {
-	return orderCache.sendMessageToStream("update", order)
+	return orderCache.sendMessageToStream(order.TenantID, "update", order, order.UpdatedAt)
+}
+
+// Delete method send message to redis stream for removing order of tenant
+func (orderCache *OrderCache) Delete(tenantID, orderID string) error {
+	return orderCache.sendMessageToStream(tenantID, "delete", &model.Order{OrderID: orderID, TenantID: tenantID}, orderCache.nextVersion())
+}
+
+// Preload method puts order read from database into cache unless cache
+// already holds it or its tombstone, so newer state received from stream
+// isn't overwritten. UpdatedAt of order is its version. Preloaded orders
+// aren't published to stream
+func (orderCache *OrderCache) Preload(order *model.Order) {
+	if !orderCache.Healthy() {
+		return
+	}
+	if err := orderCache.orders.Add(order.TenantID, order, order.UpdatedAt); err != nil {
+		log.Errorf("cache: can't preload order - %e", err)
+	}
+}
+
+// MarkMissing method remembers for a short time that order of tenant
+// doesn't exist, so repeated lookups of it don't reach database
+func (orderCache *OrderCache) MarkMissing(tenantID, orderID string) {
+	if orderCache.missing == nil {
+		return
+	}
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	orderCache.missing.set(tenantID, &model.Order{OrderID: orderID, TenantID: tenantID}, 0, time.Now())
+}
+
+// Missing method reports whether order of tenant was recently not found
+func (orderCache *OrderCache) Missing(tenantID, orderID string) bool {
+	if orderCache.missing == nil {
+		return false
+	}
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	_, found := orderCache.missing.get(tenantID, orderID, time.Now())
+	return found
+}
+
+func (orderCache *OrderCache) forgetMissing(tenantID, orderID string) {
+	if orderCache.missing == nil {
+		return
+	}
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	orderCache.missing.remove(tenantID, orderID)
+}
+
+// MarkReady method reports that cache is warmed up
+func (orderCache *OrderCache) MarkReady() {
+	atomic.StoreInt32(&orderCache.ready, 1)
 }
 
-// Delete method send message to redis stream for removing order
-func (orderCache *OrderCache) Delete(orderID string) error {
-	return orderCache.sendMessageToStream("delete", &model.Order{OrderID: orderID})
+// Ready method reports whether cache warm-up is finished
+func (orderCache *OrderCache) Ready() bool {
+	return atomic.LoadInt32(&orderCache.ready) == 1
 }
 
-func (orderCache *OrderCache) sendMessageToStream(method string, data interface{}) error {
+func (orderCache *OrderCache) stream(tenantID string) string {
+	return orderCache.streamName + ":" + tenantID
+}
+
+// nextVersion returns version of deletion made now. Deleted order has no
+// state to take version from, so version is unix time in microseconds, the
+// same clock UpdatedAt of orders comes from. Versions grow strictly within
+// instance
+func (orderCache *OrderCache) nextVersion() int64 {
+	for {
+		last := atomic.LoadInt64(&orderCache.version)
+		next := time.Now().UnixNano() / int64(time.Microsecond)
+		if next <= last {
+			next = last + 1
+		}
+		if atomic.CompareAndSwapInt64(&orderCache.version, last, next) {
+			return next
+		}
+	}
+}
+
+// sendMessageToStream publishes change of order. While redis is unavailable
+// change is buffered or dropped and doesn't fail the caller, so repository
+// writes go on
+func (orderCache *OrderCache) sendMessageToStream(tenantID, method string, data *model.Order, version int64) error {
+	if orderCache.redisClient == nil {
+		return orderCache.publish(tenantID, method, data, version)
+	}
+	if !orderCache.Healthy() {
+		orderCache.deferEvent(tenantID, method, data, version)
+		return nil
+	}
+	if err := orderCache.publish(tenantID, method, data, version); err != nil {
+		orderCache.markUnhealthy(err)
+		orderCache.deferEvent(tenantID, method, data, version)
+	}
+	return nil
+}
+
+func (orderCache *OrderCache) publish(tenantID, method string, data *model.Order, version int64) error {
+	if !orderCache.useStream {
+		order := *data
+		return orderCache.streamMessageHandler(tenantID, method, &order, version)
+	}
+	if err := orderCache.register(tenantID); err != nil {
+		return err
+	}
 	result := orderCache.redisClient.XAdd(&redis.XAddArgs{
-		Stream: orderCache.streamName,
+		Stream:       orderCache.stream(tenantID),
+		MaxLenApprox: orderCache.maxLen,
 		Values: map[string]interface{}{
-			"method": method,
-			"data":   data,
+			"method":  method,
+			"data":    data,
+			"version": strconv.FormatInt(version, 10),
 		},
 	})
 	if _, err := result.Result(); err != nil {
@@ -100,17 +304,96 @@ func (orderCache *OrderCache) sendMessageToStream(method string, data interface{
 	return nil
 }
 
-func (orderCache *OrderCache) streamMessageHandler(method string, order *model.Order) error {
-	orderCache.mutex.Lock()
-	defer orderCache.mutex.Unlock()
+// streamMessageHandler applies change of version to cache. Change older
+// than cached version of order is ignored and counted as stale
+func (orderCache *OrderCache) streamMessageHandler(tenantID, method string, order *model.Order, version int64) error {
+	var applied bool
+	var err error
 	switch method {
 	case "save", "update":
-		orderCache.orders[order.OrderID] = order
-		return nil
+		order.TenantID = tenantID
+		orderCache.forgetMissing(tenantID, order.OrderID)
+		applied, err = orderCache.orders.Set(tenantID, order, version)
 	case "delete":
-		delete(orderCache.orders, order.OrderID)
-		return nil
+		applied, err = orderCache.orders.Delete(tenantID, order.OrderID, version)
 	default:
 		return fmt.Errorf("cache handler: invalid method type")
 	}
+	if err != nil {
+		return err
+	}
+	if !applied {
+		orderCache.metrics.staleEvent(method)
+		log.WithFields(log.Fields{
+			"tenantID": tenantID,
+			"orderID":  order.OrderID,
+			"method":   method,
+			"version":  version,
+		}).Debug("cache: stale change ignored")
+	}
+	return nil
+}
+
+// invalidateAll drops all cached orders, it is used when changes could
+// have been missed
+func (orderCache *OrderCache) invalidateAll() {
+	orderCache.metrics.invalidated("all")
+	if err := orderCache.orders.Clear(); err != nil {
+		log.Errorf("cache: can't invalidate orders - %e", err)
+	}
+	if orderCache.missing != nil {
+		orderCache.mutex.Lock()
+		orderCache.missing.clear()
+		orderCache.mutex.Unlock()
+	}
+}
+
+// NeedsRedis function reports whether cache configured by cfg uses redis
+func NeedsRedis(cfg configs.Config) bool {
+	return hasSource(cfg, sourceStream) || cfg.CacheStore == storeRedis || cfg.CacheStore == storeTiered
+}
+
+// evict drops order from cache of every tenant, it is used when tenant of
+// removed order is unknown
+func (orderCache *OrderCache) evict(orderID string) {
+	orderCache.metrics.invalidated("order")
+	if err := orderCache.orders.DeleteOrder(orderID); err != nil {
+		log.Errorf("cache: can't evict order - %e", err)
+	}
+}
+
+// consumerNames returns consumer group and consumer name of instance.
+// Consumer defaults to host. Every instance needs all changes, so it needs
+// its own group, which defaults to one derived from consumer. The group must
+// keep its name across restarts, else messages published while instance was
+// down are lost, so consumer must be stable too
+func consumerNames(cfg configs.Config) (group, consumer string) {
+	group, consumer = cfg.StreamGroup, cfg.StreamConsumer
+	if consumer == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "crudserver"
+		}
+		consumer = host
+	}
+	if group == "" {
+		group = "crudserver-" + consumer
+	}
+	return group, consumer
+}
+
+func hasSource(cfg configs.Config, source string) bool {
+	for _, s := range cfg.CacheSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
 }
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"github.com/EgorBessonov/CRUDServer/internal/metrics"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"testing"
+)
+
+func TestStreamMessageHandlerStaleEvents(t *testing.T) {
+	type change struct {
+		method  string
+		name    string
+		version int64
+	}
+	tests := []struct {
+		name      string
+		cached    change
+		event     change
+		wantFound bool
+		wantName  string
+		wantStale bool
+	}{
+		{"newer update is applied", change{"save", "old", 10}, change{"update", "new", 20}, true, "new", false},
+		{"same version is applied", change{"save", "old", 10}, change{"update", "new", 10}, true, "new", false},
+		{"older update is rejected", change{"update", "new", 20}, change{"update", "old", 10}, true, "new", true},
+		{"older save is rejected", change{"update", "new", 20}, change{"save", "old", 10}, true, "new", true},
+		{"newer delete is applied", change{"save", "old", 10}, change{"delete", "", 11}, false, "", false},
+		{"older delete is rejected", change{"update", "new", 20}, change{"delete", "", 10}, true, "new", true},
+		{"update older than delete is rejected", change{"delete", "", 20}, change{"update", "old", 10}, false, "", true},
+		{"update newer than delete is applied", change{"delete", "", 20}, change{"update", "new", 30}, true, "new", false},
+		{"unversioned update is applied", change{"update", "old", 20}, change{"update", "new", 0}, true, "new", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetrics(metrics.NewRegistry())
+			orderCache := &OrderCache{orders: NewLocalStore(context.Background(), 0, 0, 0, 0), metrics: m}
+			for _, c := range []change{tt.cached, tt.event} {
+				order := &model.Order{OrderID: "order", OrderName: c.name}
+				if err := orderCache.streamMessageHandler("tenant", c.method, order, c.version); err != nil {
+					t.Fatalf("streamMessageHandler failed - %v", err)
+				}
+			}
+			order, found, err := orderCache.orders.Get("tenant", "order")
+			if err != nil {
+				t.Fatalf("Get failed - %v", err)
+			}
+			if found != tt.wantFound || (found && order.OrderName != tt.wantName) {
+				t.Errorf("cache holds %+v, %v, want name %q, %v", order, found, tt.wantName, tt.wantFound)
+			}
+			if stale := m.stale.With(tt.event.method).Value() == 1; stale != tt.wantStale {
+				t.Errorf("event counted as stale %v, want %v", stale, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestStreamMessageHandlerInvalidMethod(t *testing.T) {
+	orderCache := &OrderCache{orders: NewLocalStore(context.Background(), 0, 0, 0, 0)}
+	if err := orderCache.streamMessageHandler("tenant", "archive", &model.Order{OrderID: "order"}, 1); err == nil {
+		t.Errorf("streamMessageHandler accepted unknown method")
+	}
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/retry"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// reasons of moving message to dead-letter stream
+const (
+	// reasonMalformed marks message which can't be decoded, retrying it
+	// can't help
+	reasonMalformed = "malformed"
+	// reasonFailed marks message which handler failed on every attempt
+	reasonFailed = "failed"
+)
+
+// DeadLetter type is stream message which couldn't be applied to cache,
+// together with the reason
+type DeadLetter struct {
+	ID        string `json:"id"`
+	Stream    string `json:"stream"`
+	MessageID string `json:"messageID"`
+	TenantID  string `json:"tenantID"`
+	Method    string `json:"method"`
+	Data      string `json:"data"`
+	Version   string `json:"version,omitempty"`
+	Reason    string `json:"reason"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts"`
+	FailedAt  int64  `json:"failedAt"`
+}
+
+// applyMessage applies message of tenant stream to cache. Malformed message
+// and message which handler failed on every attempt are moved to dead-letter
+// stream. Error is returned if message can't be dead-lettered, such message
+// isn't acknowledged and stays pending
+func (orderCache *OrderCache) applyMessage(ctx context.Context, tenantID string, message redis.XMessage) error {
+	method, order, version, err := parseMessage(message.Values)
+	if err != nil {
+		return orderCache.deadLetter(tenantID, message, reasonMalformed, err, 0)
+	}
+	attempts := 0
+	err = retry.Do(ctx, "cache message "+message.ID, orderCache.handlerPolicy, func(ctx context.Context) error {
+		attempts++
+		o := *order
+		return orderCache.streamMessageHandler(tenantID, method, &o, version)
+	})
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		// instance is stopping, message is retried after restart
+		return err
+	}
+	return orderCache.deadLetter(tenantID, message, reasonFailed, err, attempts)
+}
+
+// parseMessage decodes method, order and version of stream message
+func parseMessage(values map[string]interface{}) (string, *model.Order, int64, error) {
+	method, _ := values["method"].(string)
+	switch method {
+	case "save", "update", "delete":
+	default:
+		return "", nil, 0, fmt.Errorf("cache: message has invalid method %q", method)
+	}
+	data, ok := values["data"].(string)
+	if !ok {
+		return "", nil, 0, fmt.Errorf("cache: message has no data")
+	}
+	order := &model.Order{}
+	if err := json.Unmarshal([]byte(data), order); err != nil {
+		return "", nil, 0, fmt.Errorf("cache: can't decode message data - %w", err)
+	}
+	if order.OrderID == "" {
+		return "", nil, 0, fmt.Errorf("cache: message has no orderID")
+	}
+	// messages of instances without versioning carry no version, they are
+	// applied unconditionally
+	var version int64
+	if versionString, ok := values["version"].(string); ok {
+		var err error
+		if version, err = strconv.ParseInt(versionString, 10, 64); err != nil {
+			return "", nil, 0, fmt.Errorf("cache: message has invalid version - %w", err)
+		}
+	}
+	return method, order, version, nil
+}
+
+// deadLetter moves message of tenant stream to dead-letter stream. Raw
+// fields of message are kept, so it can be replayed as it was published
+func (orderCache *OrderCache) deadLetter(tenantID string, message redis.XMessage, reason string, cause error, attempts int) error {
+	values := map[string]interface{}{
+		"stream":    orderCache.stream(tenantID),
+		"messageID": message.ID,
+		"tenantID":  tenantID,
+		"reason":    reason,
+		"error":     cause.Error(),
+		"attempts":  attempts,
+		"failedAt":  time.Now().Unix(),
+	}
+	for _, field := range []string{"method", "data", "version"} {
+		if value, ok := message.Values[field].(string); ok {
+			values[field] = value
+		}
+	}
+	err := orderCache.redisClient.XAdd(&redis.XAddArgs{
+		Stream:       orderCache.deadLetterStream(),
+		MaxLenApprox: orderCache.deadLetterMaxLen,
+		Values:       values,
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("cache: can't move message %s to dead-letter stream - %w", message.ID, err)
+	}
+	orderCache.metrics.deadLettered(reason)
+	log.WithFields(log.Fields{
+		"stream":    orderCache.stream(tenantID),
+		"messageID": message.ID,
+		"reason":    reason,
+		"err":       cause,
+	}).Warn("cache: message moved to dead-letter stream")
+	return nil
+}
+
+// DeadLetters method returns up to limit dead letters added after afterID,
+// oldest first. Empty afterID starts from the oldest dead letter
+func (orderCache *OrderCache) DeadLetters(afterID string, limit int) ([]DeadLetter, error) {
+	if !orderCache.useStream {
+		return nil, nil
+	}
+	start := "-"
+	if afterID != "" {
+		start = "(" + afterID
+	}
+	messages, err := orderCache.redisClient.XRangeN(orderCache.deadLetterStream(), start, "+", int64(limit)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cache: can't read dead-letter stream - %w", err)
+	}
+	letters := make([]DeadLetter, 0, len(messages))
+	for _, message := range messages {
+		letters = append(letters, newDeadLetter(message))
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetter method publishes dead letter to its tenant stream again
+// and removes it from dead-letter stream. Every consumer group of stream
+// receives it, versions keep groups which applied it before intact. It
+// reports whether dead letter was found
+func (orderCache *OrderCache) ReplayDeadLetter(id string) (bool, error) {
+	if !orderCache.useStream || !validID(id) {
+		return false, nil
+	}
+	messages, err := orderCache.redisClient.XRangeN(orderCache.deadLetterStream(), id, id, 1).Result()
+	if err != nil {
+		return false, fmt.Errorf("cache: can't read dead letter %s - %w", id, err)
+	}
+	if len(messages) == 0 {
+		return false, nil
+	}
+	letter := newDeadLetter(messages[0])
+	values := map[string]interface{}{
+		"method": letter.Method,
+		"data":   letter.Data,
+	}
+	if letter.Version != "" {
+		values["version"] = letter.Version
+	}
+	err = orderCache.redisClient.XAdd(&redis.XAddArgs{
+		Stream:       orderCache.stream(letter.TenantID),
+		MaxLenApprox: orderCache.maxLen,
+		Values:       values,
+	}).Err()
+	if err != nil {
+		return false, fmt.Errorf("cache: can't replay dead letter %s - %w", id, err)
+	}
+	if _, err := orderCache.DiscardDeadLetter(id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DiscardDeadLetter method removes dead letter and reports whether it was
+// found
+func (orderCache *OrderCache) DiscardDeadLetter(id string) (bool, error) {
+	if !orderCache.useStream || !validID(id) {
+		return false, nil
+	}
+	deleted, err := orderCache.redisClient.XDel(orderCache.deadLetterStream(), id).Result()
+	if err != nil {
+		return false, fmt.Errorf("cache: can't discard dead letter %s - %w", id, err)
+	}
+	return deleted > 0, nil
+}
+
+// deadLetterStream returns stream of dead letters of all tenants. Its name
+// doesn't match tenant streams, so retention and stream stats skip it
+func (orderCache *OrderCache) deadLetterStream() string {
+	return orderCache.streamName + "-deadletter"
+}
+
+func newDeadLetter(message redis.XMessage) DeadLetter {
+	field := func(name string) string {
+		value, _ := message.Values[name].(string)
+		return value
+	}
+	letter := DeadLetter{
+		ID:        message.ID,
+		Stream:    field("stream"),
+		MessageID: field("messageID"),
+		TenantID:  field("tenantID"),
+		Method:    field("method"),
+		Data:      field("data"),
+		Version:   field("version"),
+		Reason:    field("reason"),
+		Error:     field("error"),
+	}
+	letter.Attempts, _ = strconv.Atoi(field("attempts"))
+	letter.FailedAt, _ = strconv.ParseInt(field("failedAt"), 10, 64)
+	return letter
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// policies of handling cache events while redis is unavailable
+const (
+	// policyDrop discards events, cache is flushed when redis comes back
+	policyDrop = "drop"
+	// policyBuffer keeps up to bufferSize events and publishes them when
+	// redis comes back, so other instances learn changes made meanwhile
+	policyBuffer = "buffer"
+)
+
+// defaultHealthCheckInterval is how often redis is pinged when health
+// check interval isn't set, without pings degraded cache never recovers
+const defaultHealthCheckInterval = 10 * time.Second
+
+// cacheEvent is change which couldn't be published while redis was down
+type cacheEvent struct {
+	tenantID string
+	method   string
+	order    model.Order
+	version  int64
+}
+
+// Healthy method reports whether redis used by cache is available. Cache
+// without redis is always healthy
+func (orderCache *OrderCache) Healthy() bool {
+	return atomic.LoadInt32(&orderCache.healthy) == 1
+}
+
+// markUnhealthy switches cache into degraded mode: lookups miss, so
+// requests are served from repository, and events are buffered or dropped
+func (orderCache *OrderCache) markUnhealthy(err error) {
+	if !atomic.CompareAndSwapInt32(&orderCache.healthy, 1, 0) {
+		return
+	}
+	log.WithFields(log.Fields{
+		"policy": orderCache.policy,
+		"err":    err,
+	}).Warn("cache: redis is unavailable, serving from repository")
+}
+
+// deferEvent buffers event according to policy. When buffer is full the
+// oldest event is dropped
+func (orderCache *OrderCache) deferEvent(tenantID, method string, order *model.Order, version int64) {
+	if orderCache.policy != policyBuffer || orderCache.bufferSize <= 0 {
+		orderCache.metrics.degradedEvent("dropped")
+		return
+	}
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	if len(orderCache.buffer) >= orderCache.bufferSize {
+		orderCache.buffer = orderCache.buffer[1:]
+		orderCache.metrics.degradedEvent("dropped")
+	}
+	orderCache.buffer = append(orderCache.buffer, cacheEvent{tenantID: tenantID, method: method, order: *order, version: version})
+	orderCache.metrics.degradedEvent("buffered")
+}
+
+// monitorRedis pings redis every interval, or every
+// defaultHealthCheckInterval if interval isn't positive. When redis goes
+// down cache is degraded, when it comes back cache is resynced
+func (orderCache *OrderCache) monitorRedis(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := orderCache.redisClient.Ping().Err()
+			switch {
+			case err != nil:
+				orderCache.markUnhealthy(err)
+			case !orderCache.Healthy():
+				orderCache.resync()
+			}
+		}
+	}
+}
+
+// resync drops orders cached before and during outage, because changes of
+// other instances could have been missed, publishes buffered events and
+// leaves degraded mode. Failed resync is repeated on next health check
+func (orderCache *OrderCache) resync() {
+	if err := orderCache.orders.Clear(); err != nil {
+		log.Errorf("cache: can't resync cache - %e", err)
+		return
+	}
+	if orderCache.missing != nil {
+		orderCache.mutex.Lock()
+		orderCache.missing.clear()
+		orderCache.mutex.Unlock()
+	}
+	orderCache.mutex.Lock()
+	events := orderCache.buffer
+	orderCache.buffer = nil
+	orderCache.mutex.Unlock()
+	for i := range events {
+		ev := &events[i]
+		if err := orderCache.publish(ev.tenantID, ev.method, &ev.order, ev.version); err != nil {
+			log.Errorf("cache: can't publish buffered events - %e", err)
+			orderCache.mutex.Lock()
+			orderCache.buffer = append(events[i:], orderCache.buffer...)
+			if over := len(orderCache.buffer) - orderCache.bufferSize; over > 0 {
+				orderCache.buffer = orderCache.buffer[over:]
+			}
+			orderCache.mutex.Unlock()
+			return
+		}
+		orderCache.metrics.degradedEvent("replayed")
+	}
+	atomic.StoreInt32(&orderCache.healthy, 1)
+	log.WithFields(log.Fields{
+		"replayed": len(events),
+	}).Warn("cache: redis is available again, cache resynced")
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// historyReadCount is number of messages read from stream at once when
+// cache is replayed
+const historyReadCount = 1000
+
+// History type is state of orders folded from messages of tenant streams
+type History struct {
+	Entries []HistoryEntry `json:"entries"`
+	// Messages is number of read messages, Malformed and Stale of them
+	// weren't applied
+	Messages  int `json:"messages"`
+	Malformed int `json:"malformed"`
+	Stale     int `json:"stale"`
+}
+
+// HistoryEntry type is last state of order in stream history. Order is nil
+// if order was deleted
+type HistoryEntry struct {
+	TenantID  string       `json:"tenantID"`
+	OrderID   string       `json:"orderID"`
+	Order     *model.Order `json:"order,omitempty"`
+	Version   int64        `json:"version"`
+	MessageID string       `json:"messageID"`
+}
+
+// ReadHistory function reads stream of tenant, or streams of all tenants if
+// tenantID is empty, from message fromID in pages of batchSize and folds
+// messages into last state of every order. Empty fromID reads streams from
+// the beginning. Messages are applied in stream order and version rules of
+// cache, malformed and stale messages are counted and skipped. Messages
+// trimmed by retention are lost, so history may miss old orders
+func ReadHistory(rCli *redis.Client, streamName, tenantID, fromID string, batchSize int) (*History, error) {
+	var streams []string
+	if tenantID != "" {
+		streams = []string{streamName + ":" + tenantID}
+	} else {
+		var err error
+		if streams, err = scanStreams(rCli, streamName); err != nil {
+			return nil, err
+		}
+	}
+	history := &History{}
+	entries := make(map[entryKey]*HistoryEntry)
+	for _, stream := range streams {
+		tenantID := strings.TrimPrefix(stream, streamName+":")
+		start := fromID
+		if start == "" {
+			start = "-"
+		}
+		for {
+			messages, err := rCli.XRangeN(stream, start, "+", int64(batchSize)).Result()
+			if err != nil {
+				return nil, fmt.Errorf("cache: can't read stream %s - %w", stream, err)
+			}
+			for _, message := range messages {
+				history.fold(entries, tenantID, message)
+			}
+			if len(messages) < batchSize {
+				break
+			}
+			start = "(" + messages[len(messages)-1].ID
+		}
+	}
+	history.Entries = make([]HistoryEntry, 0, len(entries))
+	for _, entry := range entries {
+		history.Entries = append(history.Entries, *entry)
+	}
+	sort.Slice(history.Entries, func(i, j int) bool {
+		a, b := history.Entries[i], history.Entries[j]
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		return a.OrderID < b.OrderID
+	})
+	return history, nil
+}
+
+// OldestMessages function returns ID of the oldest retained message of
+// stream of tenant, or of streams of all tenants if tenantID is empty, by
+// tenant. Empty streams are left out
+func OldestMessages(rCli *redis.Client, streamName, tenantID string) (map[string]string, error) {
+	var streams []string
+	if tenantID != "" {
+		streams = []string{streamName + ":" + tenantID}
+	} else {
+		var err error
+		if streams, err = scanStreams(rCli, streamName); err != nil {
+			return nil, err
+		}
+	}
+	oldest := make(map[string]string, len(streams))
+	for _, stream := range streams {
+		messages, err := rCli.XRangeN(stream, "-", "+", 1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("cache: can't read stream %s - %w", stream, err)
+		}
+		if len(messages) > 0 {
+			oldest[strings.TrimPrefix(stream, streamName+":")] = messages[0].ID
+		}
+	}
+	return oldest, nil
+}
+
+func (history *History) fold(entries map[entryKey]*HistoryEntry, tenantID string, message redis.XMessage) {
+	history.Messages++
+	method, order, version, err := parseMessage(message.Values)
+	if err != nil {
+		history.Malformed++
+		log.WithFields(log.Fields{
+			"tenantID":  tenantID,
+			"messageID": message.ID,
+			"err":       err,
+		}).Warn("cache: malformed message skipped in history")
+		return
+	}
+	key := entryKey{tenantID, order.OrderID}
+	if held, found := entries[key]; found && version != 0 && held.Version > version {
+		history.Stale++
+		return
+	}
+	entry := &HistoryEntry{TenantID: tenantID, OrderID: order.OrderID, Version: version, MessageID: message.ID}
+	if method != "delete" {
+		order.TenantID = tenantID
+		entry.Order = order
+	}
+	entries[key] = entry
+}
+
+// Replay method rebuilds cache from stream history of all tenants starting
+// at message fromID. History from the beginning replaces cache content,
+// later history is applied on top of it. It returns number of applied
+// orders and tombstones
+func (orderCache *OrderCache) Replay(fromID string) (int, error) {
+	if !orderCache.useStream {
+		return 0, fmt.Errorf("cache: can't replay history - stream source is disabled")
+	}
+	history, err := ReadHistory(orderCache.redisClient, orderCache.streamName, "", fromID, historyReadCount)
+	if err != nil {
+		return 0, err
+	}
+	if fromID == "" {
+		orderCache.invalidateAll()
+	}
+	applied := 0
+	for i := range history.Entries {
+		entry := &history.Entries[i]
+		var stored bool
+		if entry.Order != nil {
+			stored, err = orderCache.orders.Set(entry.TenantID, entry.Order, entry.Version)
+		} else {
+			stored, err = orderCache.orders.Delete(entry.TenantID, entry.OrderID, entry.Version)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("cache: can't replay order %s - %w", entry.OrderID, err)
+		}
+		if stored {
+			applied++
+		}
+	}
+	log.WithFields(log.Fields{
+		"from":      fromID,
+		"messages":  history.Messages,
+		"malformed": history.Malformed,
+		"applied":   applied,
+	}).Info("cache: history replayed")
+	return applied, nil
+}
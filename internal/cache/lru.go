@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"container/list"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"time"
+)
+
+// entryOverhead is approximate size of list element, map slot and order
+// struct without its strings
+const entryOverhead = 192
+
+// eviction reasons
+const (
+	evictCapacity = "capacity"
+	evictExpired  = "expired"
+)
+
+type entryKey struct {
+	tenantID string
+	orderID  string
+}
+
+// entry holds order of tenant and version of change which stored it. Entry
+// with nil order is tombstone of deleted order, it keeps version of delete,
+// so older changes of order aren't applied after it
+type entry struct {
+	key       entryKey
+	order     *model.Order
+	version   int64
+	size      int64
+	expiresAt time.Time
+}
+
+// lru type keeps orders of all tenants in least recently used order. It is
+// bounded by number of entries and approximate memory size, zero limit
+// disables the bound. Tombstones of deleted orders count toward bounds as
+// well. lru isn't safe for concurrent use, owner guards it: LocalStore
+// holds its own mutex around orders and OrderCache holds its mutex around
+// negative cache
+type lru struct {
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	bytes      int64
+	items      map[entryKey]*list.Element
+	order      *list.List
+	// onEvict is called with eviction reason when order is dropped to fit
+	// bounds or because it expired
+	onEvict func(reason string)
+}
+
+func newLRU(maxEntries int, maxBytes int64, ttl time.Duration) *lru {
+	return &lru{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		ttl:        ttl,
+		items:      make(map[entryKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns order and marks it recently used. Expired order is removed
+// and reported as missing, tombstone is reported as missing too
+func (c *lru) get(tenantID, orderID string, now time.Time) (*model.Order, bool) {
+	e, found := c.lookup(tenantID, orderID, now)
+	if !found || e.order == nil {
+		return nil, false
+	}
+	return e.order, true
+}
+
+// lookup returns entry of order or its tombstone and marks it recently
+// used. Expired entry is removed and reported as missing
+func (c *lru) lookup(tenantID, orderID string, now time.Time) (*entry, bool) {
+	el, found := c.items[entryKey{tenantID, orderID}]
+	if !found {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if c.expired(e, now) {
+		c.removeElement(el)
+		c.evicted(evictExpired)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e, true
+}
+
+// set stores order of tenant with version of change, renews its TTL and
+// evicts least recently used orders while cache is over its bounds
+func (c *lru) set(tenantID string, order *model.Order, version int64, now time.Time) {
+	c.put(entryKey{tenantID, order.OrderID}, order, version, now)
+}
+
+// tombstone replaces order of tenant with tombstone of version
+func (c *lru) tombstone(tenantID, orderID string, version int64, now time.Time) {
+	c.put(entryKey{tenantID, orderID}, nil, version, now)
+}
+
+func (c *lru) put(key entryKey, order *model.Order, version int64, now time.Time) {
+	size := entrySize(key, order)
+	if el, found := c.items[key]; found {
+		e := el.Value.(*entry)
+		c.bytes += size - e.size
+		e.order, e.version, e.size, e.expiresAt = order, version, size, c.expiry(now)
+		c.order.MoveToFront(el)
+	} else {
+		c.items[key] = c.order.PushFront(&entry{key: key, order: order, version: version, size: size, expiresAt: c.expiry(now)})
+		c.bytes += size
+	}
+	for c.overLimit() {
+		c.removeElement(c.order.Back())
+		c.evicted(evictCapacity)
+	}
+}
+
+func (c *lru) remove(tenantID, orderID string) {
+	if el, found := c.items[entryKey{tenantID, orderID}]; found {
+		c.removeElement(el)
+	}
+}
+
+// removeOrder drops order from every tenant
+func (c *lru) removeOrder(orderID string) {
+	for key, el := range c.items {
+		if key.orderID == orderID {
+			c.removeElement(el)
+		}
+	}
+}
+
+func (c *lru) clear() {
+	c.items = make(map[entryKey]*list.Element)
+	c.order.Init()
+	c.bytes = 0
+}
+
+// sweep removes expired orders and returns their number
+func (c *lru) sweep(now time.Time) int {
+	if c.ttl <= 0 {
+		return 0
+	}
+	removed := 0
+	for el := c.order.Back(); el != nil; {
+		prev := el.Prev()
+		if c.expired(el.Value.(*entry), now) {
+			c.removeElement(el)
+			c.evicted(evictExpired)
+			removed++
+		}
+		el = prev
+	}
+	return removed
+}
+
+func (c *lru) len() int {
+	return len(c.items)
+}
+
+func (c *lru) overLimit() bool {
+	if c.order.Len() == 0 {
+		return false
+	}
+	return (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.bytes > c.maxBytes)
+}
+
+func (c *lru) expiry(now time.Time) time.Time {
+	if c.ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(c.ttl)
+}
+
+func (c *lru) expired(e *entry, now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+func (c *lru) evicted(reason string) {
+	if c.onEvict != nil {
+		c.onEvict(reason)
+	}
+}
+
+func (c *lru) removeElement(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size
+}
+
+func entrySize(key entryKey, order *model.Order) int64 {
+	size := entryOverhead + len(key.orderID) + len(key.tenantID)
+	if order != nil {
+		size += len(order.OrderID) + len(order.OrderName) + len(order.TenantID)
+	}
+	return int64(size)
+}
@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"testing"
+	"time"
+)
+
+func TestLRUTTL(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		elapsed time.Duration
+		found   bool
+	}{
+		{"before expiry", time.Minute, 59 * time.Second, true},
+		{"at expiry", time.Minute, time.Minute, false},
+		{"after expiry", time.Minute, 2 * time.Minute, false},
+		{"zero ttl never expires", 0, 24 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasons []string
+			c := newLRU(0, 0, tt.ttl)
+			c.onEvict = func(reason string) { reasons = append(reasons, reason) }
+			c.set("tenant", &model.Order{OrderID: "order"}, 1, start)
+			_, found := c.get("tenant", "order", start.Add(tt.elapsed))
+			if found != tt.found {
+				t.Fatalf("get after %v found %v, want %v", tt.elapsed, found, tt.found)
+			}
+			if !tt.found && (c.len() != 0 || len(reasons) != 1 || reasons[0] != evictExpired) {
+				t.Errorf("expired order left %d entries and evictions %v, want 0 and [%s]", c.len(), reasons, evictExpired)
+			}
+		})
+	}
+}
+
+func TestLRUSweep(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := newLRU(0, 0, time.Minute)
+	c.set("tenant", &model.Order{OrderID: "old"}, 1, start)
+	c.set("tenant", &model.Order{OrderID: "new"}, 1, start.Add(30*time.Second))
+	if removed := c.sweep(start.Add(time.Minute)); removed != 1 {
+		t.Fatalf("sweep removed %d orders, want 1", removed)
+	}
+	if _, found := c.get("tenant", "new", start.Add(time.Minute)); !found {
+		t.Errorf("sweep removed order which isn't expired")
+	}
+}
+
+func TestLRUEviction(t *testing.T) {
+	now := time.Unix(1000, 0)
+	size := entrySize(entryKey{"tenant", "a"}, &model.Order{OrderID: "a"})
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int64
+		touch      bool
+		evicted    string
+		kept       []string
+	}{
+		{"entry limit evicts least recently stored", 2, 0, false, "a", []string{"b", "c"}},
+		{"entry limit keeps recently read", 2, 0, true, "b", []string{"a", "c"}},
+		{"byte budget evicts least recently stored", 0, 2 * size, false, "a", []string{"b", "c"}},
+		{"byte budget keeps recently read", 0, 2 * size, true, "b", []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reasons []string
+			c := newLRU(tt.maxEntries, tt.maxBytes, 0)
+			c.onEvict = func(reason string) { reasons = append(reasons, reason) }
+			c.set("tenant", &model.Order{OrderID: "a"}, 1, now)
+			c.set("tenant", &model.Order{OrderID: "b"}, 1, now)
+			if tt.touch {
+				c.get("tenant", "a", now)
+			}
+			c.set("tenant", &model.Order{OrderID: "c"}, 1, now)
+			if _, found := c.get("tenant", tt.evicted, now); found {
+				t.Errorf("order %s wasn't evicted", tt.evicted)
+			}
+			for _, orderID := range tt.kept {
+				if _, found := c.get("tenant", orderID, now); !found {
+					t.Errorf("order %s was evicted", orderID)
+				}
+			}
+			if len(reasons) != 1 || reasons[0] != evictCapacity {
+				t.Errorf("evictions %v, want [%s]", reasons, evictCapacity)
+			}
+			if tt.maxBytes > 0 && c.bytes > tt.maxBytes {
+				t.Errorf("cache holds %d bytes, want at most %d", c.bytes, tt.maxBytes)
+			}
+		})
+	}
+}
+
+func TestLRUTombstone(t *testing.T) {
+	now := time.Unix(1000, 0)
+	c := newLRU(0, 0, 0)
+	c.set("tenant", &model.Order{OrderID: "order"}, 1, now)
+	c.tombstone("tenant", "order", 2, now)
+	if _, found := c.get("tenant", "order", now); found {
+		t.Fatalf("get returned deleted order")
+	}
+	e, found := c.lookup("tenant", "order", now)
+	if !found || e.order != nil || e.version != 2 {
+		t.Fatalf("lookup returned %+v, %v, want tombstone of version 2", e, found)
+	}
+	if c.len() != 1 {
+		t.Errorf("cache holds %d entries, want tombstone only", c.len())
+	}
+	if want := entrySize(entryKey{"tenant", "order"}, nil); c.bytes != want {
+		t.Errorf("cache holds %d bytes, want tombstone size %d", c.bytes, want)
+	}
+	if _, found := c.lookup("other", "order", now); found {
+		t.Errorf("tombstone is visible to other tenant")
+	}
+}
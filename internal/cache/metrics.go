@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/metrics"
+	"time"
+)
+
+// streamLagBuckets are upper bounds in seconds of stream lag histogram
+var streamLagBuckets = []float64{.001, .01, .05, .1, .5, 1, 5, 30, 60, 300}
+
+// Metrics type holds cache metric families. Nil *Metrics records nothing
+type Metrics struct {
+	requests      *metrics.CounterVec
+	evictions     *metrics.CounterVec
+	invalidations *metrics.CounterVec
+	messages      *metrics.CounterVec
+	lag           *metrics.HistogramVec
+	localEntries  *metrics.GaugeFuncVec
+	redisHealthy  *metrics.GaugeFuncVec
+	degraded      *metrics.CounterVec
+	stale         *metrics.CounterVec
+	deadLetters   *metrics.CounterVec
+}
+
+// NewMetrics registers cache metric families in reg
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests: reg.NewCounterVec("crudserver_cache_requests_total",
+			"Order cache lookups by result.", "result"),
+		evictions: reg.NewCounterVec("crudserver_cache_evictions_total",
+			"Orders dropped from local cache to fit its bounds or on expiry.", "reason"),
+		invalidations: reg.NewCounterVec("crudserver_cache_invalidations_total",
+			"Cache invalidations by scope.", "scope"),
+		messages: reg.NewCounterVec("crudserver_cache_stream_messages_total",
+			"Stream messages applied to cache.", "source"),
+		lag: reg.NewHistogramVec("crudserver_cache_stream_lag_seconds",
+			"Time between publishing stream message and applying it to cache.", streamLagBuckets),
+		localEntries: reg.NewGaugeFuncVec("crudserver_cache_local_entries",
+			"Orders held in local cache."),
+		redisHealthy: reg.NewGaugeFuncVec("crudserver_cache_redis_healthy",
+			"Whether redis used by cache is available."),
+		degraded: reg.NewCounterVec("crudserver_cache_degraded_events_total",
+			"Cache events handled while redis was unavailable.", "action"),
+		stale: reg.NewCounterVec("crudserver_cache_stale_events_total",
+			"Changes ignored because cache held newer version of order.", "method"),
+		deadLetters: reg.NewCounterVec("crudserver_cache_dead_letters_total",
+			"Stream messages moved to dead-letter stream by reason.", "reason"),
+	}
+}
+
+func (m *Metrics) lookup(found bool) {
+	if m == nil {
+		return
+	}
+	if found {
+		m.requests.With("hit").Inc()
+		return
+	}
+	m.requests.With("miss").Inc()
+}
+
+func (m *Metrics) evicted(reason string) {
+	if m == nil {
+		return
+	}
+	m.evictions.With(reason).Inc()
+}
+
+func (m *Metrics) invalidated(scope string) {
+	if m == nil {
+		return
+	}
+	m.invalidations.With(scope).Inc()
+}
+
+// streamMessage records message applied from redis stream. Stream IDs
+// start with publishing time in milliseconds, it gives lag of message
+func (m *Metrics) streamMessage(id string, now time.Time) {
+	if m == nil {
+		return
+	}
+	m.messages.With(sourceStream).Inc()
+	ms, _ := splitID(id)
+	if ms > 0 {
+		lag := now.Sub(time.Unix(0, ms*int64(time.Millisecond)))
+		if lag < 0 {
+			lag = 0
+		}
+		m.lag.With().Observe(lag.Seconds())
+	}
+}
+
+func (m *Metrics) databaseMessage(source string) {
+	if m == nil {
+		return
+	}
+	m.messages.With(source).Inc()
+}
+
+func (m *Metrics) degradedEvent(action string) {
+	if m == nil {
+		return
+	}
+	m.degraded.With(action).Inc()
+}
+
+func (m *Metrics) staleEvent(method string) {
+	if m == nil {
+		return
+	}
+	m.stale.With(method).Inc()
+}
+
+func (m *Metrics) deadLettered(reason string) {
+	if m == nil {
+		return
+	}
+	m.deadLetters.With(reason).Inc()
+}
+
+func (m *Metrics) observeHealth(orderCache *OrderCache) {
+	if m == nil {
+		return
+	}
+	m.redisHealthy.Set(func() float64 {
+		if orderCache.Healthy() {
+			return 1
+		}
+		return 0
+	})
+}
+
+func (m *Metrics) observeLocal(store *LocalStore) {
+	if m == nil {
+		return
+	}
+	store.setOnEvict(m.evicted)
+	m.localEntries.Set(func() float64 { return float64(store.Len()) })
+}
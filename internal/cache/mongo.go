@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	configs "github.com/EgorBessonov/CRUDServer/internal/config"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongo error codes which mean that watching can't resume after token
+var lostTokenCodes = map[int32]bool{
+	260: true, // InvalidResumeToken
+	280: true, // ChangeStreamFatalError
+	286: true, // ChangeStreamHistoryLost
+}
+
+type mongoChange struct {
+	OperationType string       `bson:"operationType"`
+	FullDocument  *model.Order `bson:"fullDocument"`
+	DocumentKey   struct {
+		ID string `bson:"_id"`
+	} `bson:"documentKey"`
+}
+
+// ListenMongo method applies changes of orders collection to cache using
+// change stream, so writes made by other tools are seen too. Resume token
+// is stored in file after every change and watching continues from it after
+// restart. Change streams require mongo replica set. It does nothing unless
+// mongo source is enabled in config
+func (orderCache *OrderCache) ListenMongo(ctx context.Context, cfg configs.Config, orders *mongo.Collection) {
+	if !hasSource(cfg, sourceMongo) {
+		return
+	}
+	go func() {
+		for ctx.Err() == nil {
+			if err := orderCache.watch(ctx, orders, cfg.ResumeTokenPath); err != nil && ctx.Err() == nil {
+				log.WithFields(log.Fields{
+					"status": "failed",
+					"err":    err,
+				}).Info("mongo change stream info")
+				sleep(ctx, pollInterval)
+			}
+		}
+	}()
+}
+
+func (orderCache *OrderCache) watch(ctx context.Context, orders *mongo.Collection, tokenPath string) error {
+	token, err := loadResumeToken(tokenPath)
+	if err != nil {
+		return err
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetResumeAfter(token)
+	}
+	stream, err := orders.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil && token != nil && isLostToken(err) {
+		// changes after outdated token are lost, so watching starts over
+		log.Warnf("cache: can't resume change stream, starting over - %v", err)
+		if err := saveResumeToken(tokenPath, nil); err != nil {
+			return err
+		}
+		return fmt.Errorf("cache: can't resume change stream - %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("cache: can't watch orders - %w", err)
+	}
+	defer stream.Close(context.Background())
+	if token == nil {
+		orderCache.invalidateAll()
+	}
+	for stream.Next(ctx) {
+		var c mongoChange
+		if err := stream.Decode(&c); err != nil {
+			log.Errorf("cache: invalid change event - %e", err)
+			continue
+		}
+		orderCache.applyMongoChange(&c)
+		if err := saveResumeToken(tokenPath, stream.ResumeToken()); err != nil {
+			log.Errorf("cache: can't save resume token - %e", err)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return fmt.Errorf("cache: change stream failed - %w", err)
+	}
+	return nil
+}
+
+func (orderCache *OrderCache) applyMongoChange(c *mongoChange) {
+	orderCache.metrics.databaseMessage(sourceMongo)
+	var err error
+	switch c.OperationType {
+	case "insert", "update", "replace":
+		if c.FullDocument == nil {
+			// document was removed before update was looked up
+			orderCache.evict(c.DocumentKey.ID)
+			return
+		}
+		method := "update"
+		if c.OperationType == "insert" {
+			method = "save"
+		}
+		// UpdatedAt of looked up document is version of change, so
+		// delayed event can't overwrite newer state
+		err = orderCache.streamMessageHandler(c.FullDocument.TenantID, method, c.FullDocument, c.FullDocument.UpdatedAt)
+	case "delete":
+		orderCache.evict(c.DocumentKey.ID)
+	case "drop", "rename", "dropDatabase", "invalidate":
+		orderCache.invalidateAll()
+	}
+	if err != nil {
+		log.Errorf("cache: can't apply change event - %e", err)
+	}
+}
+
+func loadResumeToken(path string) (bson.Raw, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) || len(data) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cache: can't read resume token - %w", err)
+	}
+	token := bson.Raw(data)
+	if err := token.Validate(); err != nil {
+		log.Warnf("cache: invalid resume token is ignored - %v", err)
+		return nil, nil
+	}
+	return token, nil
+}
+
+func saveResumeToken(path string, token bson.Raw) error {
+	if path == "" {
+		return nil
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, token, 0o600); err != nil {
+		return fmt.Errorf("cache: can't write resume token - %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cache: can't write resume token - %w", err)
+	}
+	return nil
+}
+
+func isLostToken(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && lostTokenCodes[cmdErr.Code]
+}
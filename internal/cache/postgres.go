@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	configs "github.com/EgorBessonov/CRUDServer/internal/config"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// postgresChannel is channel which orders table trigger notifies
+const postgresChannel = "orders_changes"
+
+type change struct {
+	Method  string      `json:"method"`
+	Version int64       `json:"version"`
+	Order   model.Order `json:"order"`
+}
+
+// ListenPostgres method applies changes of orders table announced by
+// database trigger to cache, so writes which bypass Service are seen too.
+// It does nothing unless postgres source is enabled in config
+func (orderCache *OrderCache) ListenPostgres(ctx context.Context, cfg configs.Config, pool *pgxpool.Pool) {
+	if !hasSource(cfg, sourcePostgres) {
+		return
+	}
+	go func() {
+		for ctx.Err() == nil {
+			if err := orderCache.listen(ctx, pool); err != nil && ctx.Err() == nil {
+				log.WithFields(log.Fields{
+					"status": "failed",
+					"err":    err,
+				}).Info("postgres notifications info")
+				sleep(ctx, pollInterval)
+			}
+		}
+	}()
+}
+
+func (orderCache *OrderCache) listen(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("cache: can't acquire postgres connection - %w", err)
+	}
+	defer conn.Release()
+	// listening connection must not go back to pool
+	defer conn.Conn().Close(context.Background())
+	if _, err := conn.Exec(ctx, "listen "+postgresChannel); err != nil {
+		return fmt.Errorf("cache: can't listen %s - %w", postgresChannel, err)
+	}
+	// notifications sent while nobody listened are lost
+	orderCache.invalidateAll()
+	for {
+		notification, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("cache: can't receive notification - %w", err)
+		}
+		var c change
+		if err := json.Unmarshal([]byte(notification.Payload), &c); err != nil {
+			log.Errorf("cache: invalid notification - %e", err)
+			continue
+		}
+		orderCache.metrics.databaseMessage(sourcePostgres)
+		// trigger stamps notification with version of change, so delayed
+		// notification can't overwrite newer state
+		if err := orderCache.streamMessageHandler(c.Order.TenantID, c.Method, &c.Order, c.Version); err != nil {
+			log.Errorf("cache: can't apply notification - %e", err)
+		}
+	}
+}
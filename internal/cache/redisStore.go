@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// scanCount is number of keys requested from redis by one SCAN call
+const scanCount = 1000
+
+// tombstoneTTL is how long tombstone of deleted order is kept by store
+// without TTL
+const tombstoneTTL = 10 * time.Minute
+
+// storeScript writes value of order key unless key holds newer version.
+// Versions are unix microseconds, they fit lua numbers exactly. Mode "add"
+// writes value only if key is missing or holds older tombstone
+var storeScript = redis.NewScript(`
+local held = redis.call('GET', KEYS[1])
+if held then
+	local version = tonumber(ARGV[2])
+	local ok, stored = pcall(cjson.decode, held)
+	if not ok or type(stored) ~= 'table' then
+		stored = {}
+	end
+	local heldVersion = tonumber(stored.version or 0)
+	if ARGV[4] == 'add' and (stored.order ~= nil or heldVersion >= version) then
+		return 0
+	end
+	if version > 0 and heldVersion > version then
+		return 0
+	end
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// storedOrder is value of order key. Order is nil in tombstone
+type storedOrder struct {
+	Version int64        `json:"version"`
+	Order   *model.Order `json:"order,omitempty"`
+}
+
+// RedisStore type keeps orders in redis, one key per order, so all server
+// instances share cached orders and new instance starts with warm cache.
+// Versions are compared by redis script, so instances applying changes
+// concurrently keep the newest one
+type RedisStore struct {
+	redisClient *redis.Client
+	prefix      string
+	ttl         time.Duration
+}
+
+// NewRedisStore function returns redis store with keys starting with
+// prefix. Zero ttl keeps orders until they are deleted
+func NewRedisStore(rCli *redis.Client, prefix string, ttl time.Duration) *RedisStore {
+	return &RedisStore{redisClient: rCli, prefix: prefix, ttl: ttl}
+}
+
+// Get method returns order of tenant
+func (store *RedisStore) Get(tenantID, orderID string) (*model.Order, bool, error) {
+	data, err := store.redisClient.Get(store.key(tenantID, orderID)).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("cache: can't get order from redis - %w", err)
+	}
+	var stored storedOrder
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, false, fmt.Errorf("cache: can't decode order from redis - %w", err)
+	}
+	return stored.Order, stored.Order != nil, nil
+}
+
+// Set method stores order of tenant unless newer version of it is cached
+func (store *RedisStore) Set(tenantID string, order *model.Order, version int64) (bool, error) {
+	stored, err := store.write(tenantID, order.OrderID, storedOrder{Version: version, Order: order}, store.ttl, "set")
+	if err != nil {
+		return false, fmt.Errorf("cache: can't set order in redis - %w", err)
+	}
+	return stored, nil
+}
+
+// Add method stores order of tenant unless it or its tombstone which isn't
+// older than order is cached
+func (store *RedisStore) Add(tenantID string, order *model.Order, version int64) error {
+	if _, err := store.write(tenantID, order.OrderID, storedOrder{Version: version, Order: order}, store.ttl, "add"); err != nil {
+		return fmt.Errorf("cache: can't add order to redis - %w", err)
+	}
+	return nil
+}
+
+// Delete method replaces order of tenant with tombstone unless newer
+// version of it is cached. Tombstone expires after store TTL or after
+// tombstoneTTL if store has none
+func (store *RedisStore) Delete(tenantID, orderID string, version int64) (bool, error) {
+	ttl := store.ttl
+	if ttl <= 0 {
+		ttl = tombstoneTTL
+	}
+	deleted, err := store.write(tenantID, orderID, storedOrder{Version: version}, ttl, "set")
+	if err != nil {
+		return false, fmt.Errorf("cache: can't delete order from redis - %w", err)
+	}
+	return deleted, nil
+}
+
+// DeleteOrder method drops order of any tenant
+func (store *RedisStore) DeleteOrder(orderID string) error {
+	return store.deleteMatching(store.prefix + ":*:" + orderID)
+}
+
+// Clear method drops all orders
+func (store *RedisStore) Clear() error {
+	return store.deleteMatching(store.prefix + ":*")
+}
+
+// Size method returns number of cached orders and tombstones. It scans all
+// keys of store, so it is meant for admin use only
+func (store *RedisStore) Size() (int, error) {
+	size := 0
+	err := store.scan(store.prefix+":*", func(keys []string) error {
+		size += len(keys)
+		return nil
+	})
+	return size, err
+}
+
+func (store *RedisStore) write(tenantID, orderID string, value storedOrder, ttl time.Duration, mode string) (bool, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false, err
+	}
+	result, err := storeScript.Run(store.redisClient, []string{store.key(tenantID, orderID)},
+		data, value.Version, ttl.Milliseconds(), mode).Int64()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (store *RedisStore) deleteMatching(pattern string) error {
+	return store.scan(pattern, func(keys []string) error {
+		if err := store.redisClient.Del(keys...).Err(); err != nil {
+			return fmt.Errorf("cache: can't delete orders from redis - %w", err)
+		}
+		return nil
+	})
+}
+
+func (store *RedisStore) scan(pattern string, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := store.redisClient.Scan(cursor, pattern, scanCount).Result()
+		if err != nil {
+			return fmt.Errorf("cache: can't scan redis keys - %w", err)
+		}
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func (store *RedisStore) key(tenantID, orderID string) string {
+	return store.prefix + ":" + tenantID + ":" + orderID
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// StreamInfo type describes size of tenant stream in redis
+type StreamInfo struct {
+	Stream      string `json:"stream"`
+	Length      int64  `json:"length"`
+	FirstID     string `json:"firstID"`
+	LastID      string `json:"lastID"`
+	MemoryBytes int64  `json:"memoryBytes"`
+}
+
+// runRetention trims every tenant stream every interval, so messages older
+// than retention are removed. It uses XTRIM MINID which needs redis 6.2
+func (orderCache *OrderCache) runRetention(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			trimmed, err := orderCache.trimOlderThan(now.Add(-retention))
+			if err != nil {
+				log.Errorf("cache: stream retention failed - %e", err)
+			}
+			if trimmed > 0 {
+				log.WithFields(log.Fields{
+					"trimmed": trimmed,
+				}).Info("cache: old stream messages trimmed")
+			}
+		}
+	}
+}
+
+// trimOlderThan removes messages published before t from every tenant
+// stream. Trimming is approximate, redis removes whole nodes only
+func (orderCache *OrderCache) trimOlderThan(t time.Time) (int64, error) {
+	streams, err := orderCache.streamKeys()
+	if err != nil {
+		return 0, err
+	}
+	minID := strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10) + "-0"
+	var trimmed int64
+	for _, stream := range streams {
+		n, err := orderCache.redisClient.Do("XTRIM", stream, "MINID", "~", minID).Int64()
+		if err != nil {
+			return trimmed, fmt.Errorf("cache: can't trim stream %s - %w", stream, err)
+		}
+		trimmed += n
+	}
+	return trimmed, nil
+}
+
+// StreamInfos method returns length, first and last message IDs and memory
+// usage of every tenant stream
+func (orderCache *OrderCache) StreamInfos() ([]StreamInfo, error) {
+	if !orderCache.useStream {
+		return nil, nil
+	}
+	streams, err := orderCache.streamKeys()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]StreamInfo, 0, len(streams))
+	for _, stream := range streams {
+		info := StreamInfo{Stream: stream}
+		if info.Length, err = orderCache.redisClient.XLen(stream).Result(); err != nil {
+			return nil, fmt.Errorf("cache: can't read length of stream %s - %w", stream, err)
+		}
+		if info.FirstID, err = orderCache.edgeID(stream, false); err != nil {
+			return nil, err
+		}
+		if info.LastID, err = orderCache.edgeID(stream, true); err != nil {
+			return nil, err
+		}
+		info.MemoryBytes, err = orderCache.redisClient.MemoryUsage(stream).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("cache: can't read memory usage of stream %s - %w", stream, err)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Stream < infos[j].Stream })
+	return infos, nil
+}
+
+func (orderCache *OrderCache) edgeID(stream string, last bool) (string, error) {
+	var messages []redis.XMessage
+	var err error
+	if last {
+		messages, err = orderCache.redisClient.XRevRangeN(stream, "+", "-", 1).Result()
+	} else {
+		messages, err = orderCache.redisClient.XRangeN(stream, "-", "+", 1).Result()
+	}
+	if err != nil {
+		return "", fmt.Errorf("cache: can't read stream %s - %w", stream, err)
+	}
+	if len(messages) == 0 {
+		return "", nil
+	}
+	return messages[0].ID, nil
+}
+
+// streamKeys returns keys of all tenant streams, including streams of
+// tenants which this instance hasn't registered
+func (orderCache *OrderCache) streamKeys() ([]string, error) {
+	return scanStreams(orderCache.redisClient, orderCache.streamName)
+}
+
+func scanStreams(rCli *redis.Client, streamName string) ([]string, error) {
+	var streams []string
+	var cursor uint64
+	for {
+		keys, next, err := rCli.Scan(cursor, streamName+":*", scanCount).Result()
+		if err != nil {
+			return nil, fmt.Errorf("cache: can't scan stream keys - %w", err)
+		}
+		for _, key := range keys {
+			kind, err := rCli.Type(key).Result()
+			if err != nil {
+				return nil, fmt.Errorf("cache: can't read type of key %s - %w", key, err)
+			}
+			if kind == "stream" {
+				streams = append(streams, key)
+			}
+		}
+		if next == 0 {
+			return streams, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	configs "github.com/EgorBessonov/CRUDServer/internal/config"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// store kinds
+const (
+	storeLocal  = "local"
+	storeRedis  = "redis"
+	storeTiered = "tiered"
+)
+
+// Store is storage of cached orders. Orders are kept per tenant and orders
+// of one tenant are never returned for another. Every order is stored with
+// version of change which wrote it, change older than stored version is
+// ignored, so delayed change can't overwrite newer one. Zero version marks
+// unversioned change, it is always applied
+type Store interface {
+	Get(tenantID, orderID string) (*model.Order, bool, error)
+	// Set stores order unless store holds newer version of it and reports
+	// whether order was stored
+	Set(tenantID string, order *model.Order, version int64) (bool, error)
+	// Add stores order read from database unless store already holds it or
+	// its tombstone of the same or newer version, so it never replaces state
+	// written by change
+	Add(tenantID string, order *model.Order, version int64) error
+	// Delete replaces order with tombstone unless store holds newer version
+	// of it and reports whether order was deleted
+	Delete(tenantID, orderID string, version int64) (bool, error)
+	// DeleteOrder drops order of any tenant together with its version
+	DeleteOrder(orderID string) error
+	Clear() error
+	// Size returns number of cached orders
+	Size() (int, error)
+}
+
+// NewStore function returns store selected by cfg.CacheStore. Local store
+// reports its evictions and size to m
+func NewStore(ctx context.Context, cfg configs.Config, rCli *redis.Client, m *Metrics) (Store, error) {
+	switch cfg.CacheStore {
+	case storeLocal, "":
+		local := NewLocalStore(ctx, cfg.CacheMaxEntries, cfg.CacheMaxBytes, cfg.CacheTTL, cfg.CacheSweepInterval)
+		m.observeLocal(local)
+		return local, nil
+	case storeRedis:
+		return NewRedisStore(rCli, cfg.CacheRedisPrefix, cfg.CacheTTL), nil
+	case storeTiered:
+		local := NewLocalStore(ctx, cfg.CacheLocalMaxEntries, 0, cfg.CacheLocalTTL, cfg.CacheSweepInterval)
+		m.observeLocal(local)
+		return NewTieredStore(local, NewRedisStore(rCli, cfg.CacheRedisPrefix, cfg.CacheTTL)), nil
+	default:
+		return nil, fmt.Errorf("cache: unknown store %q", cfg.CacheStore)
+	}
+}
+
+// LocalStore type keeps orders in process memory. It is bounded by entries
+// count and memory size, least recently used orders are evicted first, and
+// every order expires after TTL
+type LocalStore struct {
+	orders *lru
+	mutex  sync.Mutex
+}
+
+// NewLocalStore function returns local store and starts sweeping of
+// expired orders every sweepInterval until ctx is done
+func NewLocalStore(ctx context.Context, maxEntries int, maxBytes int64, ttl, sweepInterval time.Duration) *LocalStore {
+	store := &LocalStore{orders: newLRU(maxEntries, maxBytes, ttl)}
+	if ttl > 0 && sweepInterval > 0 {
+		go store.sweepExpired(ctx, sweepInterval)
+	}
+	return store
+}
+
+// Get method returns order of tenant
+func (store *LocalStore) Get(tenantID, orderID string) (*model.Order, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	order, found := store.orders.get(tenantID, orderID, time.Now())
+	return order, found, nil
+}
+
+// Set method stores order of tenant unless newer version of it is cached
+func (store *LocalStore) Set(tenantID string, order *model.Order, version int64) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := time.Now()
+	if !store.newer(tenantID, order.OrderID, version, now) {
+		return false, nil
+	}
+	store.orders.set(tenantID, order, version, now)
+	return true, nil
+}
+
+// Add method stores order of tenant unless it or its tombstone which isn't
+// older than order is cached
+func (store *LocalStore) Add(tenantID string, order *model.Order, version int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := time.Now()
+	held, found := store.orders.lookup(tenantID, order.OrderID, now)
+	if !found || (held.order == nil && held.version < version) {
+		store.orders.set(tenantID, order, version, now)
+	}
+	return nil
+}
+
+// Delete method replaces order of tenant with tombstone unless newer
+// version of it is cached
+func (store *LocalStore) Delete(tenantID, orderID string, version int64) (bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := time.Now()
+	if !store.newer(tenantID, orderID, version, now) {
+		return false, nil
+	}
+	store.orders.tombstone(tenantID, orderID, version, now)
+	return true, nil
+}
+
+// DeleteOrder method drops order of any tenant
+func (store *LocalStore) DeleteOrder(orderID string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.orders.removeOrder(orderID)
+	return nil
+}
+
+// Clear method drops all orders
+func (store *LocalStore) Clear() error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.orders.clear()
+	return nil
+}
+
+// Size method returns number of cached orders and tombstones
+func (store *LocalStore) Size() (int, error) {
+	return store.Len(), nil
+}
+
+// Len method returns number of cached orders and tombstones
+func (store *LocalStore) Len() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	return store.orders.len()
+}
+
+// newer reports whether change of version may be applied to order, store
+// mutex must be held
+func (store *LocalStore) newer(tenantID, orderID string, version int64, now time.Time) bool {
+	if version == 0 {
+		return true
+	}
+	held, found := store.orders.lookup(tenantID, orderID, now)
+	return !found || held.version <= version
+}
+
+func (store *LocalStore) setOnEvict(fn func(reason string)) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.orders.onEvict = fn
+}
+
+// sweepExpired periodically removes expired orders, so orders which are
+// never read again don't hold memory until they are evicted
+func (store *LocalStore) sweepExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			store.mutex.Lock()
+			removed := store.orders.sweep(now)
+			size := store.orders.len()
+			store.mutex.Unlock()
+			if removed > 0 {
+				log.WithFields(log.Fields{
+					"removed": removed,
+					"size":    size,
+				}).Debug("cache: expired orders swept")
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// streamReadCount is maximum number of messages read from stream at once
+const streamReadCount = 100
+
+// groupLease is how long consumer group stays owned by consumer after its
+// last claim. Instance claims its group while it reads streams, so group is
+// released this long after instance stops
+const groupLease = 30 * time.Second
+
+// errGroupShared is returned when consumer group is owned by another
+// consumer. Instances which share group split messages between them and
+// their caches diverge, so it is refused
+var errGroupShared = errors.New("cache: consumer group is used by another instance")
+
+// claimGroup takes or renews lease of consumer group for this consumer
+func (orderCache *OrderCache) claimGroup() error {
+	key := orderCache.streamName + ":owner:" + orderCache.group
+	claimed, err := orderCache.redisClient.SetNX(key, orderCache.consumer, groupLease).Result()
+	if err != nil {
+		return fmt.Errorf("cache: can't claim group %s - %w", orderCache.group, err)
+	}
+	if claimed {
+		return nil
+	}
+	owner, err := orderCache.redisClient.Get(key).Result()
+	if err == redis.Nil {
+		return orderCache.claimGroup()
+	}
+	if err != nil {
+		return fmt.Errorf("cache: can't read owner of group %s - %w", orderCache.group, err)
+	}
+	if owner != orderCache.consumer {
+		return fmt.Errorf("cache: group %s is owned by %s, every instance needs its own STREAM_GROUP - %w",
+			orderCache.group, owner, errGroupShared)
+	}
+	if err := orderCache.redisClient.Expire(key, groupLease).Err(); err != nil {
+		return fmt.Errorf("cache: can't renew group %s - %w", orderCache.group, err)
+	}
+	return nil
+}
+
+// register creates consumer group of tenant stream unless it exists. New
+// group starts from checkpoint of tenant, or from the oldest retained
+// message if tenant has no checkpoint, so messages published before group
+// existed are read too, versions skip the ones cache already has. Messages
+// delivered to this consumer before restart and not acknowledged are read
+// first
+func (orderCache *OrderCache) register(tenantID string) error {
+	orderCache.mutex.Lock()
+	_, found := orderCache.lastIDs[tenantID]
+	orderCache.mutex.Unlock()
+	if found {
+		return nil
+	}
+	start, err := orderCache.redisClient.HGet(orderCache.checkpointKey(), tenantID).Result()
+	if err == redis.Nil {
+		start = "0"
+	} else if err != nil {
+		return fmt.Errorf("cache: can't read checkpoint of tenant %s - %w", tenantID, err)
+	}
+	err = orderCache.redisClient.XGroupCreateMkStream(orderCache.stream(tenantID), orderCache.group, start).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("cache: can't create group of stream %s - %w", orderCache.stream(tenantID), err)
+	}
+	orderCache.mutex.Lock()
+	defer orderCache.mutex.Unlock()
+	if _, found := orderCache.lastIDs[tenantID]; !found {
+		orderCache.lastIDs[tenantID] = start
+		orderCache.backlog[tenantID] = true
+	}
+	return nil
+}
+
+// registerCheckpointed registers every tenant which has checkpoint, so
+// instance catches up with their streams right after start
+func (orderCache *OrderCache) registerCheckpointed() {
+	tenants, err := orderCache.redisClient.HKeys(orderCache.checkpointKey()).Result()
+	if err != nil {
+		log.Errorf("cache: can't read stream checkpoints - %e", err)
+		return
+	}
+	for _, tenantID := range tenants {
+		if err := orderCache.register(tenantID); err != nil {
+			log.Errorf("cache: can't register tenant stream - %e", err)
+		}
+	}
+}
+
+func (orderCache *OrderCache) readStreams(ctx context.Context) {
+	orderCache.mutex.Lock()
+	tenants := make(map[string]string, len(orderCache.lastIDs))
+	streams := make([]string, 0, 2*len(orderCache.lastIDs))
+	ids := make([]string, 0, len(orderCache.lastIDs))
+	for tenantID := range orderCache.lastIDs {
+		// pending messages of this consumer are read from the beginning,
+		// then only new messages are requested
+		id := ">"
+		if orderCache.backlog[tenantID] {
+			id = "0"
+		}
+		tenants[orderCache.stream(tenantID)] = tenantID
+		streams = append(streams, orderCache.stream(tenantID))
+		ids = append(ids, id)
+	}
+	orderCache.mutex.Unlock()
+	if len(streams) == 0 {
+		sleep(ctx, pollInterval)
+		return
+	}
+	result, err := orderCache.redisClient.XReadGroup(&redis.XReadGroupArgs{
+		Group:    orderCache.group,
+		Consumer: orderCache.consumer,
+		Streams:  append(streams, ids...),
+		Count:    streamReadCount,
+		Block:    pollInterval,
+	}).Result()
+	if err == redis.Nil {
+		return
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"status": "failed",
+			"err":    err,
+		}).Info("redis stream info")
+		sleep(ctx, pollInterval)
+		return
+	}
+	for _, stream := range result {
+		tenantID := tenants[stream.Stream]
+		if len(stream.Messages) == 0 {
+			orderCache.mutex.Lock()
+			delete(orderCache.backlog, tenantID)
+			orderCache.mutex.Unlock()
+			continue
+		}
+		orderCache.handleMessages(ctx, tenantID, stream.Messages)
+	}
+}
+
+// reclaimPending periodically takes over messages which were delivered to
+// other consumers of group and weren't acknowledged for minIdle, it happens
+// when consumer crashes or is renamed. Such messages of this consumer are
+// read again from its pending list
+func (orderCache *OrderCache) reclaimPending(ctx context.Context, interval, minIdle time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			orderCache.mutex.Lock()
+			tenants := make([]string, 0, len(orderCache.lastIDs))
+			for tenantID := range orderCache.lastIDs {
+				tenants = append(tenants, tenantID)
+			}
+			orderCache.mutex.Unlock()
+			for _, tenantID := range tenants {
+				if err := orderCache.reclaim(ctx, tenantID, minIdle); err != nil {
+					log.Errorf("cache: can't reclaim pending messages - %e", err)
+				}
+			}
+		}
+	}
+}
+
+func (orderCache *OrderCache) reclaim(ctx context.Context, tenantID string, minIdle time.Duration) error {
+	stream := orderCache.stream(tenantID)
+	pending, err := orderCache.redisClient.XPendingExt(&redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  orderCache.group,
+		Start:  "-",
+		End:    "+",
+		Count:  streamReadCount,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("cache: can't read pending messages of stream %s - %w", stream, err)
+	}
+	var ids []string
+	for _, p := range pending {
+		if p.Idle < minIdle {
+			continue
+		}
+		if p.Consumer == orderCache.consumer {
+			// message failed before it could be dead-lettered, pending
+			// list of this consumer is read from the beginning again
+			orderCache.mutex.Lock()
+			orderCache.backlog[tenantID] = true
+			orderCache.mutex.Unlock()
+			continue
+		}
+		ids = append(ids, p.Id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	messages, err := orderCache.redisClient.XClaim(&redis.XClaimArgs{
+		Stream:   stream,
+		Group:    orderCache.group,
+		Consumer: orderCache.consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("cache: can't claim pending messages of stream %s - %w", stream, err)
+	}
+	log.WithFields(log.Fields{
+		"stream":   stream,
+		"messages": len(messages),
+	}).Info("cache: pending messages reclaimed")
+	orderCache.handleMessages(ctx, tenantID, messages)
+	return nil
+}
+
+// handleMessages applies messages of tenant stream to cache, acknowledges
+// them and moves tenant checkpoint forward. Messages which can't be applied
+// are moved to dead-letter stream and acknowledged too
+func (orderCache *OrderCache) handleMessages(ctx context.Context, tenantID string, messages []redis.XMessage) {
+	stream := orderCache.stream(tenantID)
+	ids := make([]string, 0, len(messages))
+	lastID := ""
+	now := time.Now()
+	for _, message := range messages {
+		orderCache.metrics.streamMessage(message.ID, now)
+		if err := orderCache.applyMessage(ctx, tenantID, message); err != nil {
+			log.Errorf("cache: can't handle stream message - %e", err)
+			continue
+		}
+		ids = append(ids, message.ID)
+		if compareIDs(message.ID, lastID) > 0 {
+			lastID = message.ID
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	if err := orderCache.redisClient.XAck(stream, orderCache.group, ids...).Err(); err != nil {
+		log.Errorf("cache: can't acknowledge messages of stream %s - %e", stream, err)
+		return
+	}
+	orderCache.mutex.Lock()
+	advanced := compareIDs(lastID, orderCache.lastIDs[tenantID]) > 0
+	if advanced {
+		orderCache.lastIDs[tenantID] = lastID
+	}
+	orderCache.mutex.Unlock()
+	if !advanced {
+		return
+	}
+	if err := orderCache.redisClient.HSet(orderCache.checkpointKey(), tenantID, lastID).Err(); err != nil {
+		log.Errorf("cache: can't save checkpoint of stream %s - %e", stream, err)
+	}
+}
+
+// checkpointKey returns redis hash which keeps last processed message ID of
+// every tenant stream for consumer group
+func (orderCache *OrderCache) checkpointKey() string {
+	return orderCache.streamName + ":checkpoint:" + orderCache.group
+}
+
+// compareIDs compares redis stream IDs, empty ID is less than any other
+func compareIDs(a, b string) int {
+	aMs, aSeq := splitID(a)
+	bMs, bSeq := splitID(b)
+	switch {
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// validID reports whether id is complete redis stream ID
+func validID(id string) bool {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	for _, part := range parts {
+		if _, err := strconv.ParseUint(part, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func splitID(id string) (ms, seq int64) {
+	if id == "" {
+		return -1, -1
+	}
+	parts := strings.SplitN(id, "-", 2)
+	ms, _ = strconv.ParseInt(parts[0], 10, 64)
+	if len(parts) == 2 {
+		seq, _ = strconv.ParseInt(parts[1], 10, 64)
+	}
+	return ms, seq
+}
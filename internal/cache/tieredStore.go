@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TieredStore type keeps small local store in front of shared store. Reads
+// missing locally go through to shared store and fill local one, writes go
+// to both stores. Shared store decides whether change is stale, local one
+// is written only if shared one accepted change
+type TieredStore struct {
+	local  Store
+	shared Store
+}
+
+// NewTieredStore function returns store which combines local and shared
+// stores
+func NewTieredStore(local, shared Store) *TieredStore {
+	return &TieredStore{local: local, shared: shared}
+}
+
+// Get method returns order of tenant from local store or from shared store
+func (store *TieredStore) Get(tenantID, orderID string) (*model.Order, bool, error) {
+	if order, found, err := store.local.Get(tenantID, orderID); err == nil && found {
+		return order, true, nil
+	}
+	order, found, err := store.shared.Get(tenantID, orderID)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	// version of shared copy is unknown, unversioned local copy is replaced
+	// by any change accepted by shared store
+	if err := store.local.Add(tenantID, order, 0); err != nil {
+		log.Errorf("cache: can't fill local store - %e", err)
+	}
+	return order, true, nil
+}
+
+// Set method stores order of tenant in both stores unless shared store
+// holds newer version of it
+func (store *TieredStore) Set(tenantID string, order *model.Order, version int64) (bool, error) {
+	stored, err := store.shared.Set(tenantID, order, version)
+	if err != nil || !stored {
+		return false, err
+	}
+	return store.local.Set(tenantID, order, version)
+}
+
+// Add method stores order of tenant in shared store unless it holds it.
+// Local store is filled on next read, so it gets order which shared store
+// kept
+func (store *TieredStore) Add(tenantID string, order *model.Order, version int64) error {
+	return store.shared.Add(tenantID, order, version)
+}
+
+// Delete method replaces order of tenant with tombstone in both stores.
+// Local copy is dropped even if shared store fails, so stale order isn't
+// served locally
+func (store *TieredStore) Delete(tenantID, orderID string, version int64) (bool, error) {
+	if _, err := store.local.Delete(tenantID, orderID, version); err != nil {
+		return false, err
+	}
+	return store.shared.Delete(tenantID, orderID, version)
+}
+
+// DeleteOrder method drops order of any tenant from both stores
+func (store *TieredStore) DeleteOrder(orderID string) error {
+	localErr := store.local.DeleteOrder(orderID)
+	if err := store.shared.DeleteOrder(orderID); err != nil {
+		return err
+	}
+	return localErr
+}
+
+// Size method returns number of orders in shared store
+func (store *TieredStore) Size() (int, error) {
+	return store.shared.Size()
+}
+
+// Clear method drops all orders from both stores
+func (store *TieredStore) Clear() error {
+	localErr := store.local.Clear()
+	if err := store.shared.Clear(); err != nil {
+		return err
+	}
+	return localErr
+}
@@ -0,0 +1,21 @@
+package cache
+
+import configs "github.com/EgorBessonov/CRUDServer/internal/config"
+
+// defaultWarmupBatchSize is warm-up page size used when it isn't configured
+const defaultWarmupBatchSize = 500
+
+// WarmupLimits function returns number of orders loaded by warm-up and
+// page size. Warm-up never loads more orders than local store holds
+func WarmupLimits(cfg configs.Config) (limit, batchSize int) {
+	limit = cfg.CacheWarmupLimit
+	if cfg.CacheMaxEntries > 0 && (cfg.CacheStore == storeLocal || cfg.CacheStore == "") &&
+		(limit <= 0 || limit > cfg.CacheMaxEntries) {
+		limit = cfg.CacheMaxEntries
+	}
+	batchSize = cfg.CacheWarmupBatchSize
+	if batchSize <= 0 {
+		batchSize = defaultWarmupBatchSize
+	}
+	return limit, batchSize
+}
@@ -1,12 +1,56 @@
 // Package configs represents config structure
 package configs
 
+import "time"
+
 // Config type store all env info
 type Config struct {
-	SecretKey     string `env:"SECRETKEY"`
-	CurrentDB     string `env:"CURRENTDB" envDefault:"postgres"`
-	PostgresdbURL string `env:"POSTGRESDB_URL"`
-	MongodbURL    string `env:"MONGODB_URL"`
-	RedisURL      string `env:"REDISDB_URL"`
-	StreamName    string `env:"STREAMNAME"`
+	SecretKey               string        `env:"SECRETKEY"`
+	AdminKey                string        `env:"ADMINKEY"`
+	CurrentDB               string        `env:"CURRENTDB" envDefault:"postgres"`
+	DualWriteDB             string        `env:"DUALWRITEDB"`
+	PostgresdbURL           string        `env:"POSTGRESDB_URL"`
+	PostgresReplicaURLs     []string      `env:"POSTGRESDB_REPLICA_URLS" envSeparator:","`
+	ReplicaCheckInterval    time.Duration `env:"POSTGRESDB_REPLICA_CHECK_INTERVAL" envDefault:"5s"`
+	MongodbURL              string        `env:"MONGODB_URL"`
+	SqlitedbURL             string        `env:"SQLITEDB_URL" envDefault:"crudserver.db"`
+	SnapshotPath            string        `env:"SNAPSHOT_PATH"`
+	RedisURL                string        `env:"REDISDB_URL"`
+	StreamName              string        `env:"STREAMNAME"`
+	CacheSources            []string      `env:"CACHE_SOURCES" envSeparator:"," envDefault:"stream"`
+	ResumeTokenPath         string        `env:"MONGO_RESUME_TOKEN_PATH" envDefault:"mongo.resume-token"`
+	ConnectAttempts         int           `env:"CONNECT_ATTEMPTS" envDefault:"5"`
+	ConnectBackoff          time.Duration `env:"CONNECT_BACKOFF" envDefault:"500ms"`
+	ConnectMaxBackoff       time.Duration `env:"CONNECT_MAX_BACKOFF" envDefault:"10s"`
+	HealthCheckInterval     time.Duration `env:"HEALTH_CHECK_INTERVAL" envDefault:"10s"`
+	SlowQueryThreshold      time.Duration `env:"SLOW_QUERY_THRESHOLD" envDefault:"200ms"`
+	ArchiveInterval         time.Duration `env:"ARCHIVE_INTERVAL" envDefault:"24h"`
+	ArchiveAfterDays        int           `env:"ARCHIVE_AFTER_DAYS" envDefault:"30"`
+	ArchiveBatchSize        int           `env:"ARCHIVE_BATCH_SIZE" envDefault:"500"`
+	CacheMaxEntries         int           `env:"CACHE_MAX_ENTRIES" envDefault:"10000"`
+	CacheMaxBytes           int64         `env:"CACHE_MAX_BYTES" envDefault:"67108864"`
+	CacheTTL                time.Duration `env:"CACHE_TTL" envDefault:"5m"`
+	CacheSweepInterval      time.Duration `env:"CACHE_SWEEP_INTERVAL" envDefault:"1m"`
+	CacheStore              string        `env:"CACHE_STORE" envDefault:"local"`
+	CacheRedisPrefix        string        `env:"CACHE_REDIS_PREFIX" envDefault:"orders"`
+	CacheLocalMaxEntries    int           `env:"CACHE_LOCAL_MAX_ENTRIES" envDefault:"1000"`
+	CacheLocalTTL           time.Duration `env:"CACHE_LOCAL_TTL" envDefault:"30s"`
+	CacheNegativeTTL        time.Duration `env:"CACHE_NEGATIVE_TTL" envDefault:"5s"`
+	CacheNegativeMaxEntries int           `env:"CACHE_NEGATIVE_MAX_ENTRIES" envDefault:"10000"`
+	CacheDegradedPolicy     string        `env:"CACHE_DEGRADED_POLICY" envDefault:"drop"`
+	CacheBufferSize         int           `env:"CACHE_BUFFER_SIZE" envDefault:"10000"`
+	CacheWarmup             bool          `env:"CACHE_WARMUP"`
+	CacheWarmupLimit        int           `env:"CACHE_WARMUP_LIMIT"`
+	CacheWarmupBatchSize    int           `env:"CACHE_WARMUP_BATCH_SIZE" envDefault:"500"`
+	StreamMaxLen            int64         `env:"STREAM_MAXLEN" envDefault:"100000"`
+	StreamRetention         time.Duration `env:"STREAM_RETENTION" envDefault:"24h"`
+	StreamRetentionInterval time.Duration `env:"STREAM_RETENTION_INTERVAL" envDefault:"10m"`
+	StreamGroup             string        `env:"STREAM_GROUP"`
+	StreamConsumer          string        `env:"STREAM_CONSUMER"`
+	StreamReclaimInterval   time.Duration `env:"STREAM_RECLAIM_INTERVAL" envDefault:"30s"`
+	StreamReclaimMinIdle    time.Duration `env:"STREAM_RECLAIM_MIN_IDLE" envDefault:"1m"`
+	StreamHandlerAttempts   int           `env:"STREAM_HANDLER_ATTEMPTS" envDefault:"3"`
+	StreamHandlerBackoff    time.Duration `env:"STREAM_HANDLER_BACKOFF" envDefault:"100ms"`
+	StreamHandlerMaxBackoff time.Duration `env:"STREAM_HANDLER_MAX_BACKOFF" envDefault:"1s"`
+	StreamDeadLetterMaxLen  int64         `env:"STREAM_DEADLETTER_MAXLEN" envDefault:"10000"`
 }
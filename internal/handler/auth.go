@@ -11,24 +11,27 @@ import (
 
 // Registration godoc
 // @Summary Registration
-// @Description Registration method is echo authentication method(POST) for creating user
+// @Description Registration method is echo authentication method(POST) for creating user in default tenant, tenantID of body is ignored
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param authUser body model.AuthUser true "auth user instance"
 // @Success 200 {string} string
+// @Failure 400 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /registration [post]
 func (h *Handler) Registration(c echo.Context) error {
 	authUser := model.AuthUser{}
-	if err := (&echo.DefaultBinder{}).BindBody(c, &authUser); err != nil {
-		log.Errorf("handler: registration failed - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while parsing json")
+	if err := bindBody(c, &authUser); err != nil {
+		return err
 	}
 	err := h.s.Registration(c.Request().Context(), &authUser)
 	if err != nil {
-		log.Errorf("handler: registration failed - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while saving form.")
+		return fmt.Errorf("handler: registration failed - %w", err)
 	}
 	return c.String(http.StatusOK, "successfully.")
 }
@@ -41,21 +44,24 @@ func (h *Handler) Registration(c echo.Context) error {
 // @Produce json
 // @Param "email & password" body model.AuthUser true "user password & email"
 // @Success 200 {string} string
+// @Failure 400 {object} echo.HTTPError
+// @Failure 401 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /authentication [post]
 func (h *Handler) Authentication(c echo.Context) error {
 	authUser := struct {
 		Email    string
 		Password string
 	}{}
-	if err := (&echo.DefaultBinder{}).BindBody(c, &authUser); err != nil {
-		log.Errorf("handler: authentication failed - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while parsing json")
+	if err := bindBody(c, &authUser); err != nil {
+		return err
 	}
 	accessTokenString, refreshTokenString, err := h.s.Authentication(c.Request().Context(), authUser.Email, authUser.Password)
 	if err != nil {
-		log.Errorf("handler: authentication failed - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintln(err))
+		return fmt.Errorf("handler: authentication failed - %w", err)
 	}
 	return c.JSONBlob(
 		http.StatusOK,
@@ -76,7 +82,10 @@ func (h *Handler) Authentication(c echo.Context) error {
 // @Param refreshToken query string true "refresh token string"
 // @Success 200 {string} string
 // @Failure 400 {object} echo.HTTPError
+// @Failure 401 {object} echo.HTTPError
+// @Failure 403 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /refreshToken{refreshToken} [get]
 func (h *Handler) RefreshToken(c echo.Context) error {
 	refreshTokenString := c.QueryParam("refreshToken")
@@ -86,8 +95,7 @@ func (h *Handler) RefreshToken(c echo.Context) error {
 	}
 	newAccessTokenString, newRefreshTokenString, err := h.s.RefreshToken(c.Request().Context(), refreshTokenString)
 	if err != nil {
-		log.Errorf("handler: token refresh failed - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while creating tokens")
+		return fmt.Errorf("handler: token refresh failed - %w", err)
 	}
 	return c.JSONBlob(
 		http.StatusOK,
@@ -120,8 +128,7 @@ func (h *Handler) Logout(c echo.Context) error {
 	}
 	err := h.s.UpdateAuthUser(c.Request().Context(), email, "")
 	if err != nil {
-		log.Errorf("handler: logout failed - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "logout error.")
+		return fmt.Errorf("handler: logout failed - %w", err)
 	}
 	return c.String(http.StatusOK, "logout successfully")
 }
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/cache"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultDeadLettersLimit is number of dead letters returned when limit
+// isn't given
+const defaultDeadLettersLimit = 100
+
+// CacheStats godoc
+// @Summary CacheStats
+// @Description CacheStats is echo handler(GET) which returns cache size and stream consumer position
+// @Tags admin
+// @Produce json
+// @Success 200 {object} cache.Stats
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/cache [get]
+// @Security ApiKeyAuth
+func (h *Handler) CacheStats(c echo.Context) error {
+	stats, err := h.s.CacheStats()
+	if err != nil {
+		return fmt.Errorf("handler: can't get cache stats - %w", err)
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// InvalidateCachedOrder godoc
+// @Summary InvalidateCachedOrder
+// @Description InvalidateCachedOrder is echo handler(DELETE) which drops order from cache of every instance
+// @Tags admin
+// @Produce json
+// @Param tenantID query string false "tenantID"
+// @Param orderID query string true "orderID"
+// @Success 200 {string} string
+// @Failure 422 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/cache/orders [delete]
+// @Security ApiKeyAuth
+func (h *Handler) InvalidateCachedOrder(c echo.Context) error {
+	tenantID := c.QueryParam("tenantID")
+	if tenantID == "" {
+		tenantID = tenant.DefaultID
+	}
+	if err := h.s.InvalidateCachedOrder(tenantID, c.QueryParam("orderID")); err != nil {
+		return fmt.Errorf("handler: can't invalidate cached order - %w", err)
+	}
+	return c.String(http.StatusOK, fmt.Sprintln("successfully invalidated."))
+}
+
+// FlushCache godoc
+// @Summary FlushCache
+// @Description FlushCache is echo handler(POST) which drops all orders cached by instance
+// @Tags admin
+// @Produce json
+// @Success 200 {string} string
+// @Router /admin/cache/flush [post]
+// @Security ApiKeyAuth
+func (h *Handler) FlushCache(c echo.Context) error {
+	h.s.FlushCache()
+	return c.String(http.StatusOK, fmt.Sprintln("successfully flushed."))
+}
+
+// RebuildCache godoc
+// @Summary RebuildCache
+// @Description RebuildCache is echo handler(POST) which flushes cache and loads orders from repository again
+// @Tags admin
+// @Produce json
+// @Success 200 {object} map[string]int
+// @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
+// @Router /admin/cache/rebuild [post]
+// @Security ApiKeyAuth
+func (h *Handler) RebuildCache(c echo.Context) error {
+	limit, batchSize := cache.WarmupLimits(*h.cfg)
+	loaded, err := h.s.RebuildCache(c.Request().Context(), limit, batchSize)
+	if err != nil {
+		return fmt.Errorf("handler: can't rebuild cache - %w", err)
+	}
+	return c.JSON(http.StatusOK, map[string]int{"loaded": loaded})
+}
+
+// ReplayCache godoc
+// @Summary ReplayCache
+// @Description ReplayCache is echo handler(POST) which rebuilds cache of instance from stream history starting at message fromID, without fromID whole history replaces cache content
+// @Tags admin
+// @Produce json
+// @Param fromID query string false "fromID"
+// @Success 200 {object} map[string]int
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/cache/replay [post]
+// @Security ApiKeyAuth
+func (h *Handler) ReplayCache(c echo.Context) error {
+	applied, err := h.s.ReplayCache(c.QueryParam("fromID"))
+	if err != nil {
+		return fmt.Errorf("handler: can't replay cache - %w", err)
+	}
+	return c.JSON(http.StatusOK, map[string]int{"applied": applied})
+}
+
+// StreamStats godoc
+// @Summary StreamStats
+// @Description StreamStats is echo handler(GET) which returns length, first and last message IDs and memory usage of every tenant stream
+// @Tags admin
+// @Produce json
+// @Success 200 {array} cache.StreamInfo
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/streams [get]
+// @Security ApiKeyAuth
+func (h *Handler) StreamStats(c echo.Context) error {
+	infos, err := h.s.StreamInfos()
+	if err != nil {
+		return fmt.Errorf("handler: can't get stream stats - %w", err)
+	}
+	return c.JSON(http.StatusOK, infos)
+}
+
+// DeadLetters godoc
+// @Summary DeadLetters
+// @Description DeadLetters is echo handler(GET) which returns stream messages which couldn't be applied to cache, oldest first
+// @Tags admin
+// @Produce json
+// @Param afterID query string false "afterID"
+// @Param limit query int false "limit"
+// @Success 200 {array} cache.DeadLetter
+// @Failure 400 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/deadletters [get]
+// @Security ApiKeyAuth
+func (h *Handler) DeadLetters(c echo.Context) error {
+	limit := defaultDeadLettersLimit
+	if value := c.QueryParam("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintln("invalid limit."))
+		}
+	}
+	letters, err := h.s.DeadLetters(c.QueryParam("afterID"), limit)
+	if err != nil {
+		return fmt.Errorf("handler: can't get dead letters - %w", err)
+	}
+	return c.JSON(http.StatusOK, letters)
+}
+
+// ReplayDeadLetter godoc
+// @Summary ReplayDeadLetter
+// @Description ReplayDeadLetter is echo handler(POST) which publishes dead letter to its tenant stream again
+// @Tags admin
+// @Produce json
+// @Param id query string true "id"
+// @Success 200 {string} string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/deadletters/replay [post]
+// @Security ApiKeyAuth
+func (h *Handler) ReplayDeadLetter(c echo.Context) error {
+	if err := h.s.ReplayDeadLetter(c.QueryParam("id")); err != nil {
+		return fmt.Errorf("handler: can't replay dead letter - %w", err)
+	}
+	return c.String(http.StatusOK, fmt.Sprintln("successfully replayed."))
+}
+
+// DiscardDeadLetter godoc
+// @Summary DiscardDeadLetter
+// @Description DiscardDeadLetter is echo handler(DELETE) which removes dead letter without applying it
+// @Tags admin
+// @Produce json
+// @Param id query string true "id"
+// @Success 200 {string} string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Router /admin/deadletters [delete]
+// @Security ApiKeyAuth
+func (h *Handler) DiscardDeadLetter(c echo.Context) error {
+	if err := h.s.DiscardDeadLetter(c.QueryParam("id")); err != nil {
+		return fmt.Errorf("handler: can't discard dead letter - %w", err)
+	}
+	return c.String(http.StatusOK, fmt.Sprintln("successfully discarded."))
+}
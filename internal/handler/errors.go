@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/service"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrorHandler function returns echo error handler which maps repository
+// error kinds to http statuses and renders them with echo default handler,
+// so every error response has the same body
+func ErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		e.DefaultHTTPErrorHandler(httpError(err), c)
+	}
+}
+
+// bindBody binds request body into i. Malformed body is client error, so
+// it is reported as bad request with the same body as other errors
+func bindBody(c echo.Context, i interface{}) error {
+	if err := (&echo.DefaultBinder{}).BindBody(c, i); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid request body").SetInternal(err)
+	}
+	return nil
+}
+
+func httpError(err error) *echo.HTTPError {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		status, message = http.StatusNotFound, repository.ErrNotFound.Error()
+	case errors.Is(err, repository.ErrConflict):
+		status, message = http.StatusConflict, repository.ErrConflict.Error()
+	case errors.Is(err, repository.ErrValidation):
+		status, message = http.StatusUnprocessableEntity, repository.ErrValidation.Error()
+		var rErr *repository.Error
+		if errors.As(err, &rErr) && rErr.Kind == repository.ErrValidation {
+			message += ": " + rErr.Err.Error()
+		}
+	case errors.Is(err, service.ErrUnauthorized):
+		status, message = http.StatusUnauthorized, service.ErrUnauthorized.Error()
+	case errors.Is(err, service.ErrTenantDisabled):
+		status, message = http.StatusForbidden, service.ErrTenantDisabled.Error()
+	case errors.Is(err, repository.ErrUnavailable):
+		status, message = http.StatusServiceUnavailable, repository.ErrUnavailable.Error()
+	default:
+		status, message = http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+	}
+	if status >= http.StatusInternalServerError {
+		log.Errorf("handler: request failed - %v", err)
+	} else {
+		log.Debugf("handler: request failed - %v", err)
+	}
+	return echo.NewHTTPError(status, message).SetInternal(err)
+}
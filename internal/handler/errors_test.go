@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{"not found", repository.NewError(repository.ErrNotFound, "order %s not found", "1"),
+			http.StatusNotFound, repository.ErrNotFound.Error()},
+		{"conflict", repository.NewError(repository.ErrConflict, "order %s already exists", "1"),
+			http.StatusConflict, repository.ErrConflict.Error()},
+		{"validation keeps reason", repository.NewError(repository.ErrValidation, "empty orderID"),
+			http.StatusUnprocessableEntity, repository.ErrValidation.Error() + ": empty orderID"},
+		{"unavailable", repository.NewError(repository.ErrUnavailable, "database is down"),
+			http.StatusServiceUnavailable, repository.ErrUnavailable.Error()},
+		{"wrapped kind", fmt.Errorf("service: can't get order - %w", repository.NewError(repository.ErrNotFound, "order not found")),
+			http.StatusNotFound, repository.ErrNotFound.Error()},
+		{"unauthorized", fmt.Errorf("service: invalid password - %w", service.ErrUnauthorized),
+			http.StatusUnauthorized, service.ErrUnauthorized.Error()},
+		{"disabled tenant", fmt.Errorf("service: tenant is disabled - %w", service.ErrTenantDisabled),
+			http.StatusForbidden, service.ErrTenantDisabled.Error()},
+		{"http error is kept", echo.NewHTTPError(http.StatusBadRequest, "invalid request body"),
+			http.StatusBadRequest, "invalid request body"},
+		{"unknown error hides details", fmt.Errorf("handler: secret details"),
+			http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			rec := httptest.NewRecorder()
+			c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+			ErrorHandler(e)(tt.err, c)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var body struct {
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatalf("can't decode body - %v", err)
+			}
+			if body.Message != tt.wantMessage {
+				t.Errorf("message %q, want %q", body.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestBindBody(t *testing.T) {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"orderName": `))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	var body struct {
+		OrderName string `json:"orderName"`
+	}
+	err := bindBody(e.NewContext(req, httptest.NewRecorder()), &body)
+	if httpErr := httpError(err); httpErr.Code != http.StatusBadRequest {
+		t.Errorf("malformed body returned status %d, want %d", httpErr.Code, http.StatusBadRequest)
+	}
+}
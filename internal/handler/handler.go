@@ -5,6 +5,8 @@ import (
 	"fmt"
 	configs "github.com/EgorBessonov/CRUDServer/internal/config"
 	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/retry"
 	"github.com/EgorBessonov/CRUDServer/internal/service"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
@@ -13,8 +15,9 @@ import (
 
 // Handler type replies for handling echo server requests
 type Handler struct {
-	s   *service.Service
-	cfg *configs.Config
+	s            *service.Service
+	cfg          *configs.Config
+	dependencies []*retry.Health
 }
 
 // NewHandler function create handler for working with
@@ -31,19 +34,19 @@ func NewHandler(s *service.Service, cfg *configs.Config) *Handler {
 // @Produce json
 // @Param order body model.Order true "order instance"
 // @Success 200 {string} string
+// @Failure 422 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /saveOrder [post]
 // @Security ApiKeyAuth
 func (h *Handler) SaveOrder(c echo.Context) error {
 	order := model.Order{}
-	if err := (&echo.DefaultBinder{}).BindBody(c, &order); err != nil {
-		log.Error(fmt.Errorf("handler: can't save order - %w", err))
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error while saving"))
+	if err := bindBody(c, &order); err != nil {
+		return err
 	}
 	orderID, err := h.s.Save(c.Request().Context(), &order)
 	if err != nil {
-		log.Error(fmt.Errorf("handler: can't save order - %w", err))
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Errorf("error while saving"))
+		return fmt.Errorf("handler: can't save order - %w", err)
 	}
 	return c.JSONBlob(
 		http.StatusOK,
@@ -60,15 +63,17 @@ func (h *Handler) SaveOrder(c echo.Context) error {
 // @Produce json
 // @Param orderID query string true "orderID"
 // @Success 200 {string} string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /getOrder{orderID} [get]
 // @Security ApiKeyAuth
 func (h *Handler) GetOrderByID(c echo.Context) error {
 	orderID := c.QueryParam("orderID")
 	order, err := h.s.Get(c.Request().Context(), orderID)
 	if err != nil {
-		log.Error(fmt.Errorf("handler: can't get order - %w", err))
-		return echo.NewHTTPError(http.StatusInternalServerError, fmt.Sprintln("get operation failed"))
+		return fmt.Errorf("handler: can't get order - %w", err)
 	}
 
 	return c.JSONBlob(
@@ -90,15 +95,17 @@ func (h *Handler) GetOrderByID(c echo.Context) error {
 // @Produce json
 // @Param orderID query string true "orderID"
 // @Success 200 {string} string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /deleteOrder{orderID} [delete]
 // @Security ApiKeyAuth
 func (h *Handler) DeleteOrderByID(c echo.Context) error {
 	orderID := c.QueryParam("orderID")
 	err := h.s.Delete(c.Request().Context(), orderID)
 	if err != nil {
-		log.Error(fmt.Errorf("handler: can't delete order - %w", err))
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while deleting")
+		return fmt.Errorf("handler: can't delete order - %w", err)
 	}
 	return c.String(http.StatusOK, fmt.Sprintln("successfully deleted."))
 }
@@ -111,23 +118,47 @@ func (h *Handler) DeleteOrderByID(c echo.Context) error {
 // @Produce json
 // @Param order body model.Order true "order instance"
 // @Success 200 {string} string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
 // @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
 // @Router /updateOrder [put]
 // @Security ApiKeyAuth
 func (h *Handler) UpdateOrderByID(c echo.Context) error {
 	order := model.Order{}
-	if err := (&echo.DefaultBinder{}).BindBody(c, &order); err != nil {
-		log.Error("handler: can't update order - error while parsing")
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while parsing json")
+	if err := bindBody(c, &order); err != nil {
+		return err
 	}
 	err := h.s.Update(c.Request().Context(), &order)
 	if err != nil {
-		log.Errorf("handler: can't update order - %e", err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "error while updating user")
+		return fmt.Errorf("handler: can't update order - %w", err)
 	}
 	return c.String(http.StatusOK, fmt.Sprintln("successfully updated."))
 }
 
+// GetArchivedOrder godoc
+// @Summary GetArchivedOrder
+// @Description GetArchivedOrder is echo handler(GET) which returns json structure of archived Order object
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param orderID query string true "orderID"
+// @Success 200 {object} model.Order
+// @Failure 404 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
+// @Router /getArchivedOrder{orderID} [get]
+// @Security ApiKeyAuth
+func (h *Handler) GetArchivedOrder(c echo.Context) error {
+	orderID := c.QueryParam("orderID")
+	order, err := h.s.GetArchived(c.Request().Context(), orderID)
+	if err != nil {
+		return fmt.Errorf("handler: can't get archived order - %w", err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
 // UploadImage godoc
 // @Summary UploadImage
 // @Description UploadImage is echo handler(POST) for uploading user images from server
@@ -170,3 +201,12 @@ func (h *Handler) DownloadImage(c echo.Context) error {
 	}
 	return c.File("images/" + imageName)
 }
+
+// ReadAfterWrite is echo middleware which lets repository serve request
+// reads from replicas until request makes its first write
+func ReadAfterWrite(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.SetRequest(c.Request().WithContext(repository.WithReadAfterWrite(c.Request().Context())))
+		return next(c)
+	}
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/retry"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WatchDependency method makes instance unready while dependency is
+// unhealthy. Nil health is ignored
+func (h *Handler) WatchDependency(health *retry.Health) {
+	if health != nil {
+		h.dependencies = append(h.dependencies, health)
+	}
+}
+
+// Ready godoc
+// @Summary Ready
+// @Description Ready is echo handler(GET) for readiness probe. It responds with 503 until cache warm-up is finished and while database is unavailable
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /ready [get]
+func (h *Handler) Ready(c echo.Context) error {
+	if !h.s.Ready() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": "warming up"})
+	}
+	for _, dependency := range h.dependencies {
+		if !dependency.Healthy() {
+			return c.JSON(http.StatusServiceUnavailable, map[string]string{"status": dependency.Name() + " is unavailable"})
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]string{"status": "ready"})
+}
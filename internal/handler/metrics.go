@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/metrics"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics function returns echo handler(GET) which exposes metrics of reg
+// in prometheus text format
+func Metrics(reg *metrics.Registry) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return reg.Write(c.Response())
+	}
+}
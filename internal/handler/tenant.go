@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/service"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"net/http"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Tenant is echo middleware which must follow jwt middleware. It scopes
+// request to tenant from token claims and rejects tenants which are disabled
+func (h *Handler) Tenant(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := c.Get("user").(*jwt.Token)
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "missing token.")
+		}
+		claims, ok := token.Claims.(*service.CustomClaims)
+		if !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "invalid token claims.")
+		}
+		tenantID := claims.TenantID
+		if tenantID == "" {
+			tenantID = tenant.DefaultID
+		}
+		if err := h.s.CheckTenant(c.Request().Context(), tenantID); err != nil {
+			return fmt.Errorf("handler: tenant check failed - %w", err)
+		}
+		c.SetRequest(c.Request().WithContext(tenant.WithID(c.Request().Context(), tenantID)))
+		return next(c)
+	}
+}
+
+// AllTenants is echo middleware of admin endpoints which lets them work
+// with data of all tenants
+func AllTenants(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.SetRequest(c.Request().WithContext(tenant.AllTenants(c.Request().Context())))
+		return next(c)
+	}
+}
+
+// AdminKeyValidator function returns key validator for admin endpoints.
+// Empty admin key disables admin endpoints
+func AdminKeyValidator(adminKey string) middleware.KeyAuthValidator {
+	return func(key string, c echo.Context) (bool, error) {
+		if adminKey == "" {
+			return false, nil
+		}
+		return subtle.ConstantTimeCompare([]byte(key), []byte(adminKey)) == 1, nil
+	}
+}
+
+// CreateTenant godoc
+// @Summary CreateTenant
+// @Description CreateTenant is echo handler(POST) which creates tenant
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenant body model.Tenant true "tenant instance"
+// @Success 200 {string} string
+// @Failure 409 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
+// @Router /admin/tenants [post]
+// @Security ApiKeyAuth
+func (h *Handler) CreateTenant(c echo.Context) error {
+	t := model.Tenant{}
+	if err := bindBody(c, &t); err != nil {
+		return err
+	}
+	t.Disabled = false
+	if err := h.s.CreateTenant(c.Request().Context(), &t); err != nil {
+		return fmt.Errorf("handler: can't create tenant - %w", err)
+	}
+	return c.String(http.StatusOK, fmt.Sprintln("successfully created."))
+}
+
+// DisableTenant godoc
+// @Summary DisableTenant
+// @Description DisableTenant is echo handler(PUT) which disables tenant
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenantID query string true "tenantID"
+// @Success 200 {string} string
+// @Failure 404 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
+// @Router /admin/tenants/disable{tenantID} [put]
+// @Security ApiKeyAuth
+func (h *Handler) DisableTenant(c echo.Context) error {
+	tenantID := c.QueryParam("tenantID")
+	if err := h.s.DisableTenant(c.Request().Context(), tenantID); err != nil {
+		return fmt.Errorf("handler: can't disable tenant - %w", err)
+	}
+	return c.String(http.StatusOK, fmt.Sprintln("successfully disabled."))
+}
+
+// RegisterTenantUser godoc
+// @Summary RegisterTenantUser
+// @Description RegisterTenantUser is echo handler(POST) which creates user in tenant
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param tenantID query string true "tenantID"
+// @Param authUser body model.AuthUser true "auth user instance"
+// @Success 200 {string} string
+// @Failure 403 {object} echo.HTTPError
+// @Failure 409 {object} echo.HTTPError
+// @Failure 422 {object} echo.HTTPError
+// @Failure 500 {object} echo.HTTPError
+// @Failure 503 {object} echo.HTTPError
+// @Router /admin/tenants/users{tenantID} [post]
+// @Security ApiKeyAuth
+func (h *Handler) RegisterTenantUser(c echo.Context) error {
+	authUser := model.AuthUser{}
+	if err := bindBody(c, &authUser); err != nil {
+		return err
+	}
+	if err := h.s.RegisterTenantUser(c.Request().Context(), c.QueryParam("tenantID"), &authUser); err != nil {
+		return fmt.Errorf("handler: can't register tenant user - %w", err)
+	}
+	return c.String(http.StatusOK, fmt.Sprintln("successfully registered."))
+}
@@ -0,0 +1,329 @@
+// Package metrics replies collecting application metrics and exposing them
+// in prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBuckets are latency histogram buckets in seconds
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is registry exposed by metrics endpoint
+var Default = NewRegistry()
+
+type family interface {
+	write(w io.Writer) error
+}
+
+// Registry type holds metric families in registration order
+type Registry struct {
+	mutex    sync.Mutex
+	names    map[string]bool
+	families []family
+}
+
+// NewRegistry returns empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// register adds family to registry. Family which name is already taken is
+// logged and left out of exposition, so its series still can be used but
+// first registered family keeps the name
+func (r *Registry) register(name string, f family) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.names[name] {
+		log.Errorf("metrics: %s registered twice, second family isn't exposed", name)
+		return
+	}
+	r.names[name] = true
+	r.families = append(r.families, f)
+}
+
+// Registered method reports whether metric family name is registered
+func (r *Registry) Registered(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.names[name]
+}
+
+// Write method writes all metrics in prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	families := append([]family(nil), r.families...)
+	r.mutex.Unlock()
+	for _, f := range families {
+		if err := f.write(w); err != nil {
+			return fmt.Errorf("metrics: can't write metrics - %w", err)
+		}
+	}
+	return nil
+}
+
+// vec type keeps one series per label values combination
+type vec struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+	mutex      sync.RWMutex
+	series     map[string]interface{}
+	newSeries  func() interface{}
+}
+
+// with returns series for label values. Wrong number of values is logged
+// and gets detached series, so callers on request path never fail
+func (v *vec) with(values []string) interface{} {
+	if !v.validLabels(values) {
+		return v.newSeries()
+	}
+	key := strings.Join(values, "\xff")
+	v.mutex.RLock()
+	s, found := v.series[key]
+	v.mutex.RUnlock()
+	if found {
+		return s
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if s, found := v.series[key]; found {
+		return s
+	}
+	s = v.newSeries()
+	v.series[key] = s
+	return s
+}
+
+func (v *vec) validLabels(values []string) bool {
+	if len(values) != len(v.labelNames) {
+		log.Errorf("metrics: %s expects %d labels, got %d", v.name, len(v.labelNames), len(values))
+		return false
+	}
+	return true
+}
+
+func (v *vec) write(w io.Writer, writeSeries func(w io.Writer, labels string, s interface{}) error) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind); err != nil {
+		return err
+	}
+	v.mutex.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	series := make([]interface{}, len(keys))
+	for i, key := range keys {
+		series[i] = v.series[key]
+	}
+	v.mutex.RUnlock()
+	for i, key := range keys {
+		if err := writeSeries(w, v.labels(key), series[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v *vec) labels(key string) string {
+	if len(v.labelNames) == 0 {
+		return ""
+	}
+	values := strings.Split(key, "\xff")
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = fmt.Sprintf("%s=%q", v.labelNames[i], value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func newVec(name, help, kind string, labelNames []string, newSeries func() interface{}) *vec {
+	return &vec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+		series:     make(map[string]interface{}),
+		newSeries:  newSeries,
+	}
+}
+
+// Counter type is monotonically increasing value
+type Counter struct {
+	value uint64
+}
+
+// Inc method increments counter by one
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add method increments counter by n
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value method returns current counter value
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// CounterVec type is counter family partitioned by labels
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec registers counter family in registry
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	v := &CounterVec{newVec(name, help, "counter", labelNames, func() interface{} { return &Counter{} })}
+	r.register(name, v)
+	return v
+}
+
+// With method returns counter for label values
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values).(*Counter)
+}
+
+func (v *CounterVec) write(w io.Writer) error {
+	return v.vec.write(w, func(w io.Writer, labels string, s interface{}) error {
+		_, err := fmt.Fprintf(w, "%s%s %d\n", v.name, braces(labels), s.(*Counter).Value())
+		return err
+	})
+}
+
+// Histogram type counts observations in cumulative buckets
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sumBits uint64
+}
+
+// Observe method records one observation
+func (h *Histogram) Observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			atomic.AddUint64(&h.counts[i], 1)
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sumBits)
+		sum := math.Float64frombits(old) + value
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, math.Float64bits(sum)) {
+			return
+		}
+	}
+}
+
+// HistogramVec type is histogram family partitioned by labels
+type HistogramVec struct {
+	*vec
+}
+
+// NewHistogramVec registers histogram family with buckets in registry
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	v := &HistogramVec{newVec(name, help, "histogram", labelNames, func() interface{} {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+	})}
+	r.register(name, v)
+	return v
+}
+
+// With method returns histogram for label values
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values).(*Histogram)
+}
+
+func (v *HistogramVec) write(w io.Writer) error {
+	return v.vec.write(w, func(w io.Writer, labels string, s interface{}) error {
+		h := s.(*Histogram)
+		prefix := labels
+		if prefix != "" {
+			prefix += ","
+		}
+		for i, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket{%sle=\"%g\"} %d\n", v.name, prefix, bound, atomic.LoadUint64(&h.counts[i])); err != nil {
+				return err
+			}
+		}
+		count := atomic.LoadUint64(&h.count)
+		sum := math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+		_, err := fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n%s_sum%s %g\n%s_count%s %d\n",
+			v.name, prefix, count, v.name, braces(labels), sum, v.name, braces(labels), count)
+		return err
+	})
+}
+
+// funcVec type is family which values are read on exposition
+type funcVec struct {
+	*vec
+}
+
+func newFuncVec(name, help, kind string, labelNames []string) *funcVec {
+	return &funcVec{newVec(name, help, kind, labelNames, func() interface{} { return new(func() float64) })}
+}
+
+// GaugeFuncVec type is gauge family which values are read on exposition
+type GaugeFuncVec struct {
+	*funcVec
+}
+
+// NewGaugeFuncVec registers gauge family in registry
+func (r *Registry) NewGaugeFuncVec(name, help string, labelNames ...string) *GaugeFuncVec {
+	v := &GaugeFuncVec{newFuncVec(name, help, "gauge", labelNames)}
+	r.register(name, v)
+	return v
+}
+
+// CounterFuncVec type is counter family which values are read on
+// exposition, functions must return monotonically increasing values
+type CounterFuncVec struct {
+	*funcVec
+}
+
+// NewCounterFuncVec registers counter family in registry
+func (r *Registry) NewCounterFuncVec(name, help string, labelNames ...string) *CounterFuncVec {
+	v := &CounterFuncVec{newFuncVec(name, help, "counter", labelNames)}
+	r.register(name, v)
+	return v
+}
+
+// Set method sets function which returns value for label values
+func (v *funcVec) Set(fn func() float64, values ...string) {
+	if !v.validLabels(values) {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.series[strings.Join(values, "\xff")] = &fn
+}
+
+func (v *funcVec) write(w io.Writer) error {
+	return v.vec.write(w, func(w io.Writer, labels string, s interface{}) error {
+		fn := *s.(*func() float64)
+		if fn == nil {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "%s%s %g\n", v.name, braces(labels), fn())
+		return err
+	})
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
@@ -0,0 +1,369 @@
+// Package migrator replies copying data between repository implementations
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"hash"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Migrator type copies tenants, orders, archived orders and auth users from
+// source to target repository in batches. Progress is stored in checkpoint file after every
+// batch, so interrupted migration continues where it stopped
+type Migrator struct {
+	src            repository.Repository
+	dst            repository.Repository
+	batchSize      int
+	checkpointPath string
+}
+
+// Checkpoint type represents migration progress
+type Checkpoint struct {
+	TenantsAfter    string `json:"tenantsAfter"`
+	TenantsDone     bool   `json:"tenantsDone"`
+	TenantsCopied   int    `json:"tenantsCopied"`
+	OrdersAfter     string `json:"ordersAfter"`
+	OrdersDone      bool   `json:"ordersDone"`
+	OrdersCopied    int    `json:"ordersCopied"`
+	ArchivedAfter   string `json:"archivedAfter"`
+	ArchivedDone    bool   `json:"archivedDone"`
+	ArchivedCopied  int    `json:"archivedCopied"`
+	AuthUsersAfter  string `json:"authUsersAfter"`
+	AuthUsersDone   bool   `json:"authUsersDone"`
+	AuthUsersCopied int    `json:"authUsersCopied"`
+}
+
+// Summary type represents entity count and checksum in one repository
+type Summary struct {
+	Count    int    `json:"count"`
+	Checksum string `json:"checksum"`
+}
+
+// Report type represents result of comparing source and target repository
+type Report struct {
+	SourceTenants   Summary `json:"sourceTenants"`
+	TargetTenants   Summary `json:"targetTenants"`
+	SourceOrders    Summary `json:"sourceOrders"`
+	TargetOrders    Summary `json:"targetOrders"`
+	SourceArchived  Summary `json:"sourceArchived"`
+	TargetArchived  Summary `json:"targetArchived"`
+	SourceAuthUsers Summary `json:"sourceAuthUsers"`
+	TargetAuthUsers Summary `json:"targetAuthUsers"`
+}
+
+// Match reports whether target holds exactly the same data as source
+func (r Report) Match() bool {
+	return r.SourceTenants == r.TargetTenants && r.SourceOrders == r.TargetOrders &&
+		r.SourceArchived == r.TargetArchived && r.SourceAuthUsers == r.TargetAuthUsers
+}
+
+// NewMigrator returns migrator from src to dst. Empty checkpointPath
+// disables resuming
+func NewMigrator(src, dst repository.Repository, batchSize int, checkpointPath string) *Migrator {
+	return &Migrator{src: src, dst: dst, batchSize: batchSize, checkpointPath: checkpointPath}
+}
+
+// Run method copies all tenants, then all orders, archived orders and then
+// all auth users.
+// Entities which already exist in target are overwritten, so batch can be
+// safely repeated
+func (m *Migrator) Run(ctx context.Context) error {
+	cp, err := m.loadCheckpoint()
+	if err != nil {
+		return err
+	}
+	for !cp.TenantsDone {
+		tenants, err := m.src.GetTenants(ctx, cp.TenantsAfter, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("migrator: can't read tenants - %w", err)
+		}
+		for _, t := range tenants {
+			if err := m.copyTenant(ctx, t); err != nil {
+				return err
+			}
+			cp.TenantsAfter = t.TenantID
+		}
+		cp.TenantsCopied += len(tenants)
+		cp.TenantsDone = len(tenants) < m.batchSize
+		if err := m.saveCheckpoint(cp); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"copied": cp.TenantsCopied,
+		}).Info("migrator: tenants batch copied")
+	}
+	for !cp.OrdersDone {
+		orders, err := m.src.GetOrders(ctx, cp.OrdersAfter, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("migrator: can't read orders - %w", err)
+		}
+		for _, order := range orders {
+			if err := m.copyOrder(ctx, order); err != nil {
+				return err
+			}
+			cp.OrdersAfter = order.OrderID
+		}
+		cp.OrdersCopied += len(orders)
+		cp.OrdersDone = len(orders) < m.batchSize
+		if err := m.saveCheckpoint(cp); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"copied": cp.OrdersCopied,
+		}).Info("migrator: orders batch copied")
+	}
+	for !cp.ArchivedDone {
+		orders, err := m.src.GetArchivedOrders(ctx, cp.ArchivedAfter, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("migrator: can't read archived orders - %w", err)
+		}
+		for _, order := range orders {
+			if err := m.dst.SaveArchivedOrder(ctx, order); err != nil {
+				return fmt.Errorf("migrator: can't copy archived order %s - %w", order.OrderID, err)
+			}
+			cp.ArchivedAfter = order.OrderID
+		}
+		cp.ArchivedCopied += len(orders)
+		cp.ArchivedDone = len(orders) < m.batchSize
+		if err := m.saveCheckpoint(cp); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"copied": cp.ArchivedCopied,
+		}).Info("migrator: archived orders batch copied")
+	}
+	for !cp.AuthUsersDone {
+		authUsers, err := m.src.GetAuthUsers(ctx, cp.AuthUsersAfter, m.batchSize)
+		if err != nil {
+			return fmt.Errorf("migrator: can't read authUsers - %w", err)
+		}
+		for _, authUser := range authUsers {
+			if err := m.copyAuthUser(ctx, authUser); err != nil {
+				return err
+			}
+			cp.AuthUsersAfter = authUser.UserUUID
+		}
+		cp.AuthUsersCopied += len(authUsers)
+		cp.AuthUsersDone = len(authUsers) < m.batchSize
+		if err := m.saveCheckpoint(cp); err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"copied": cp.AuthUsersCopied,
+		}).Info("migrator: authUsers batch copied")
+	}
+	return nil
+}
+
+// Verify method compares entity counts and checksums of source and target
+func (m *Migrator) Verify(ctx context.Context) (*Report, error) {
+	var report Report
+	var err error
+	if report.SourceTenants, err = summarizeTenants(ctx, m.src, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.TargetTenants, err = summarizeTenants(ctx, m.dst, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.SourceOrders, err = summarizeOrders(ctx, m.src, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.TargetOrders, err = summarizeOrders(ctx, m.dst, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.SourceArchived, err = summarizeArchivedOrders(ctx, m.src, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.TargetArchived, err = summarizeArchivedOrders(ctx, m.dst, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.SourceAuthUsers, err = summarizeAuthUsers(ctx, m.src, m.batchSize); err != nil {
+		return nil, err
+	}
+	if report.TargetAuthUsers, err = summarizeAuthUsers(ctx, m.dst, m.batchSize); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (m *Migrator) copyTenant(ctx context.Context, t *model.Tenant) error {
+	err := m.dst.SaveTenant(ctx, t)
+	if errors.Is(err, repository.ErrConflict) {
+		err = m.dst.UpdateTenant(ctx, t)
+	}
+	if err != nil {
+		return fmt.Errorf("migrator: can't copy tenant %s - %w", t.TenantID, err)
+	}
+	return nil
+}
+
+func (m *Migrator) copyOrder(ctx context.Context, order *model.Order) error {
+	err := m.dst.Save(ctx, order)
+	if errors.Is(err, repository.ErrConflict) {
+		err = m.dst.Update(ctx, order)
+	}
+	if err != nil {
+		return fmt.Errorf("migrator: can't copy order %s - %w", order.OrderID, err)
+	}
+	return nil
+}
+
+func (m *Migrator) copyAuthUser(ctx context.Context, authUser *model.AuthUser) error {
+	err := m.dst.SaveAuthUser(ctx, authUser)
+	if err != nil && !errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("migrator: can't copy authUser %s - %w", authUser.UserUUID, err)
+	}
+	if err := m.dst.UpdateAuthUser(ctx, authUser.Email, authUser.RefreshToken); err != nil {
+		return fmt.Errorf("migrator: can't copy authUser %s refresh token - %w", authUser.UserUUID, err)
+	}
+	return nil
+}
+
+func (m *Migrator) loadCheckpoint() (*Checkpoint, error) {
+	var cp Checkpoint
+	if m.checkpointPath == "" {
+		return &cp, nil
+	}
+	data, err := os.ReadFile(m.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return &cp, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("migrator: can't read checkpoint - %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("migrator: can't parse checkpoint - %w", err)
+	}
+	log.WithFields(log.Fields{
+		"tenantsAfter":   cp.TenantsAfter,
+		"ordersAfter":    cp.OrdersAfter,
+		"archivedAfter":  cp.ArchivedAfter,
+		"authUsersAfter": cp.AuthUsersAfter,
+	}).Info("migrator: resuming from checkpoint")
+	return &cp, nil
+}
+
+func (m *Migrator) saveCheckpoint(cp *Checkpoint) error {
+	if m.checkpointPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("migrator: can't encode checkpoint - %w", err)
+	}
+	tmpPath := m.checkpointPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("migrator: can't write checkpoint - %w", err)
+	}
+	if err := os.Rename(tmpPath, m.checkpointPath); err != nil {
+		return fmt.Errorf("migrator: can't write checkpoint - %w", err)
+	}
+	return nil
+}
+
+func summarizeTenants(ctx context.Context, rps repository.Repository, batchSize int) (Summary, error) {
+	h := sha256.New()
+	count := 0
+	afterID := ""
+	for {
+		tenants, err := rps.GetTenants(ctx, afterID, batchSize)
+		if err != nil {
+			return Summary{}, fmt.Errorf("migrator: can't read tenants - %w", err)
+		}
+		for _, t := range tenants {
+			if err := writeJSON(h, t); err != nil {
+				return Summary{}, err
+			}
+			afterID = t.TenantID
+		}
+		count += len(tenants)
+		if len(tenants) < batchSize {
+			return Summary{Count: count, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+		}
+	}
+}
+
+func summarizeOrders(ctx context.Context, rps repository.Repository, batchSize int) (Summary, error) {
+	h := sha256.New()
+	count := 0
+	afterID := ""
+	for {
+		orders, err := rps.GetOrders(ctx, afterID, batchSize)
+		if err != nil {
+			return Summary{}, fmt.Errorf("migrator: can't read orders - %w", err)
+		}
+		for _, order := range orders {
+			if err := writeJSON(h, order); err != nil {
+				return Summary{}, err
+			}
+			afterID = order.OrderID
+		}
+		count += len(orders)
+		if len(orders) < batchSize {
+			return Summary{Count: count, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+		}
+	}
+}
+
+func summarizeArchivedOrders(ctx context.Context, rps repository.Repository, batchSize int) (Summary, error) {
+	h := sha256.New()
+	count := 0
+	afterID := ""
+	for {
+		orders, err := rps.GetArchivedOrders(ctx, afterID, batchSize)
+		if err != nil {
+			return Summary{}, fmt.Errorf("migrator: can't read archived orders - %w", err)
+		}
+		for _, order := range orders {
+			if err := writeJSON(h, order); err != nil {
+				return Summary{}, err
+			}
+			afterID = order.OrderID
+		}
+		count += len(orders)
+		if len(orders) < batchSize {
+			return Summary{Count: count, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+		}
+	}
+}
+
+func summarizeAuthUsers(ctx context.Context, rps repository.Repository, batchSize int) (Summary, error) {
+	h := sha256.New()
+	count := 0
+	afterID := ""
+	for {
+		authUsers, err := rps.GetAuthUsers(ctx, afterID, batchSize)
+		if err != nil {
+			return Summary{}, fmt.Errorf("migrator: can't read authUsers - %w", err)
+		}
+		for _, authUser := range authUsers {
+			if err := writeJSON(h, authUser); err != nil {
+				return Summary{}, err
+			}
+			afterID = authUser.UserUUID
+		}
+		count += len(authUsers)
+		if len(authUsers) < batchSize {
+			return Summary{Count: count, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+		}
+	}
+}
+
+func writeJSON(h hash.Hash, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("migrator: can't encode entity - %w", err)
+	}
+	_, _ = h.Write(data)
+	_, _ = h.Write([]byte{'\n'})
+	return nil
+}
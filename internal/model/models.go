@@ -5,20 +5,35 @@ import "encoding/json"
 
 // Order type represent order structure in database
 type Order struct {
-	OrderID     string `json:"orderID"`
-	OrderName   string `json:"orderName"`
-	OrderCost   int    `json:"orderCost"`
-	IsDelivered bool   `json:"isDelivered"`
+	OrderID     string `json:"orderID" bson:"_id"`
+	OrderName   string `json:"orderName" bson:"orderName"`
+	OrderCost   int    `json:"orderCost" bson:"orderCost"`
+	IsDelivered bool   `json:"isDelivered" bson:"isDelivered"`
+	TenantID    string `json:"tenantID" bson:"tenantID"`
+	// DeliveredAt is unix time when order was marked delivered, zero while
+	// it isn't delivered
+	DeliveredAt int64 `json:"deliveredAt" bson:"deliveredAt"`
+	// UpdatedAt is unix time in microseconds when order was saved or
+	// updated last time
+	UpdatedAt int64 `json:"updatedAt" bson:"updatedAt"`
 }
 
 // AuthUser struct represents user information
 type AuthUser struct {
-	UserUUID     string `json:"userID"`
-	UserName     string `json:"userName"`
-	Email        string `json:"email"`
-	Password     string `json:"password"`
-	RefreshToken string `json:"refreshToken"`
-	ExpiresIn    string `json:"expiresIn"`
+	UserUUID     string `json:"userID" bson:"_id"`
+	UserName     string `json:"userName" bson:"userName"`
+	Email        string `json:"email" bson:"email"`
+	Password     string `json:"password" bson:"password"`
+	RefreshToken string `json:"refreshToken" bson:"refreshToken"`
+	ExpiresIn    string `json:"expiresIn" bson:"expiresIn,omitempty"`
+	TenantID     string `json:"tenantID" bson:"tenantID"`
+}
+
+// Tenant struct represents business unit which owns orders and users
+type Tenant struct {
+	TenantID string `json:"tenantID" bson:"_id"`
+	Name     string `json:"name" bson:"name"`
+	Disabled bool   `json:"disabled" bson:"disabled"`
 }
 
 func (order Order) MarshalBinary() ([]byte, error) {
@@ -0,0 +1,198 @@
+// Package replay replies rebuilding orders from history of cache streams
+// and comparing the history with repository
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/cache"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// drift kinds
+const (
+	// DriftMissing marks order which exists in history and not in repository
+	DriftMissing = "missing"
+	// DriftDeleted marks order which is deleted in history and exists in
+	// repository
+	DriftDeleted = "deleted"
+	// DriftChanged marks order which differs in history and repository
+	DriftChanged = "changed"
+	// DriftUnknown marks order which exists in repository and never appears
+	// in history
+	DriftUnknown = "unknown"
+)
+
+// Result type represents number of orders written by Rebuild
+type Result struct {
+	Saved   int `json:"saved"`
+	Deleted int `json:"deleted"`
+}
+
+// Drift type represents order which state in history differs from state in
+// repository
+type Drift struct {
+	Kind       string       `json:"kind"`
+	TenantID   string       `json:"tenantID"`
+	OrderID    string       `json:"orderID"`
+	Stream     *model.Order `json:"stream,omitempty"`
+	Repository *model.Order `json:"repository,omitempty"`
+}
+
+// Report type represents result of comparing history with repository
+type Report struct {
+	Orders  int     `json:"orders"`
+	Matched int     `json:"matched"`
+	Drifts  []Drift `json:"drifts"`
+}
+
+// Rebuild function writes last state of every order in history into rps.
+// Existing orders are overwritten and orders deleted in history are deleted,
+// so rebuild can be safely repeated
+func Rebuild(ctx context.Context, history *cache.History, rps repository.Repository) (*Result, error) {
+	result := &Result{}
+	for i := range history.Entries {
+		entry := &history.Entries[i]
+		tenantCtx := tenant.WithID(ctx, entry.TenantID)
+		if entry.Order == nil {
+			err := rps.Delete(tenantCtx, entry.OrderID)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("replay: can't delete order %s - %w", entry.OrderID, err)
+			}
+			result.Deleted++
+			continue
+		}
+		order := *entry.Order
+		err := rps.Save(tenantCtx, &order)
+		if errors.Is(err, repository.ErrConflict) {
+			err = rps.Update(tenantCtx, &order)
+		}
+		if err != nil {
+			return result, fmt.Errorf("replay: can't save order %s - %w", entry.OrderID, err)
+		}
+		result.Saved++
+		if result.Saved%1000 == 0 {
+			log.WithFields(log.Fields{
+				"saved": result.Saved,
+			}).Info("replay: rebuild progress")
+		}
+	}
+	return result, nil
+}
+
+// CheckRetention function returns error if rps has order which was updated
+// last time before the oldest retained message of its tenant stream, oldest
+// holds such messages by tenant. Changes of that order are trimmed from
+// history, so history doesn't describe rps and mustn't be written into it.
+// Empty tenantID checks orders of all tenants
+func CheckRetention(ctx context.Context, oldest map[string]string, rps repository.Repository, tenantID string, batchSize int) error {
+	scope := ctx
+	if tenantID != "" {
+		scope = tenant.WithID(ctx, tenantID)
+	}
+	oldestTimes := make(map[string]int64, len(oldest))
+	for owner, messageID := range oldest {
+		ms, err := strconv.ParseInt(strings.SplitN(messageID, "-", 2)[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("replay: invalid stream message ID %s - %w", messageID, err)
+		}
+		oldestTimes[owner] = ms * int64(time.Millisecond/time.Microsecond)
+	}
+	afterID := ""
+	for {
+		orders, err := rps.GetOrders(scope, afterID, batchSize)
+		if err != nil {
+			return fmt.Errorf("replay: can't read orders - %w", err)
+		}
+		for _, order := range orders {
+			afterID = order.OrderID
+			oldestTime, found := oldestTimes[order.TenantID]
+			if !found {
+				return fmt.Errorf("replay: stream of tenant %s has no retained messages, order %s isn't covered by history",
+					order.TenantID, order.OrderID)
+			}
+			if order.UpdatedAt < oldestTime {
+				return fmt.Errorf("replay: oldest retained message %s of tenant %s is newer than order %s updated at %s",
+					oldest[order.TenantID], order.TenantID, order.OrderID, time.UnixMicro(order.UpdatedAt).UTC().Format(time.RFC3339))
+			}
+		}
+		if len(orders) < batchSize {
+			return nil
+		}
+	}
+}
+
+// Diff function compares last state of every order in history with rps.
+// With unknown set orders of rps which never appear in history are
+// reported too, it makes sense only for history read from the beginning of
+// untrimmed streams. Empty tenantID compares orders of all tenants
+func Diff(ctx context.Context, history *cache.History, rps repository.Repository, tenantID string, batchSize int, unknown bool) (*Report, error) {
+	report := &Report{Orders: len(history.Entries)}
+	seen := make(map[string]bool, len(history.Entries))
+	for i := range history.Entries {
+		entry := &history.Entries[i]
+		seen[entry.TenantID+"/"+entry.OrderID] = true
+		stored, err := rps.Get(tenant.WithID(ctx, entry.TenantID), entry.OrderID)
+		if errors.Is(err, repository.ErrNotFound) {
+			stored, err = nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("replay: can't get order %s - %w", entry.OrderID, err)
+		}
+		drift := Drift{TenantID: entry.TenantID, OrderID: entry.OrderID, Stream: entry.Order, Repository: stored}
+		switch {
+		case entry.Order == nil && stored == nil:
+			report.Matched++
+			continue
+		case entry.Order == nil:
+			drift.Kind = DriftDeleted
+		case stored == nil:
+			drift.Kind = DriftMissing
+		case *entry.Order != *stored:
+			drift.Kind = DriftChanged
+		default:
+			report.Matched++
+			continue
+		}
+		report.Drifts = append(report.Drifts, drift)
+	}
+	if !unknown {
+		return report, nil
+	}
+	scope := ctx
+	if tenantID != "" {
+		scope = tenant.WithID(ctx, tenantID)
+	}
+	afterID := ""
+	for {
+		orders, err := rps.GetOrders(scope, afterID, batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("replay: can't read orders - %w", err)
+		}
+		for _, order := range orders {
+			afterID = order.OrderID
+			if !seen[order.TenantID+"/"+order.OrderID] {
+				report.Drifts = append(report.Drifts, Drift{
+					Kind:       DriftUnknown,
+					TenantID:   order.TenantID,
+					OrderID:    order.OrderID,
+					Repository: order,
+				})
+			}
+		}
+		if len(orders) < batchSize {
+			return report, nil
+		}
+	}
+}
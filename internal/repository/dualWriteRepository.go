@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DualWriteRepository type writes to both primary and secondary repository
+// while all reads come from primary. Primary is the source of truth: its
+// errors are returned to caller, secondary errors are only logged
+type DualWriteRepository struct {
+	Primary   Repository
+	Secondary Repository
+	// pending collects secondary writes made inside primary transaction,
+	// they are applied only after the transaction is committed
+	pending *[]func(context.Context) error
+}
+
+// NewDualWriteRepository returns repository writing to primary and secondary
+func NewDualWriteRepository(primary, secondary Repository) *DualWriteRepository {
+	return &DualWriteRepository{Primary: primary, Secondary: secondary}
+}
+
+// Save method saves order into primary and secondary repository
+func (rps *DualWriteRepository) Save(ctx context.Context, order *model.Order) error {
+	if err := rps.Primary.Save(ctx, order); err != nil {
+		return err
+	}
+	saved := *order
+	rps.secondary(ctx, "save order", func(ctx context.Context) error {
+		return rps.Secondary.Save(ctx, &saved)
+	})
+	return nil
+}
+
+// Get method returns order from primary repository
+func (rps *DualWriteRepository) Get(ctx context.Context, orderID string) (*model.Order, error) {
+	return rps.Primary.Get(ctx, orderID)
+}
+
+// Update method updates order in primary and secondary repository
+func (rps *DualWriteRepository) Update(ctx context.Context, order *model.Order) error {
+	if err := rps.Primary.Update(ctx, order); err != nil {
+		return err
+	}
+	updated := *order
+	rps.secondary(ctx, "update order", func(ctx context.Context) error {
+		return rps.Secondary.Update(ctx, &updated)
+	})
+	return nil
+}
+
+// Delete method deletes order from primary and secondary repository
+func (rps *DualWriteRepository) Delete(ctx context.Context, orderID string) error {
+	if err := rps.Primary.Delete(ctx, orderID); err != nil {
+		return err
+	}
+	rps.secondary(ctx, "delete order", func(ctx context.Context) error {
+		return rps.Secondary.Delete(ctx, orderID)
+	})
+	return nil
+}
+
+// SaveAuthUser method saves user into primary and secondary repository
+// with the same UserUUID
+func (rps *DualWriteRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) error {
+	if err := rps.Primary.SaveAuthUser(ctx, authUser); err != nil {
+		return err
+	}
+	saved := *authUser
+	rps.secondary(ctx, "save authUser", func(ctx context.Context) error {
+		return rps.Secondary.SaveAuthUser(ctx, &saved)
+	})
+	return nil
+}
+
+// GetAuthUser method returns user from primary repository
+func (rps *DualWriteRepository) GetAuthUser(ctx context.Context, email string) (*model.AuthUser, error) {
+	return rps.Primary.GetAuthUser(ctx, email)
+}
+
+// GetAuthUserByID method returns user from primary repository
+func (rps *DualWriteRepository) GetAuthUserByID(ctx context.Context, userID string) (*model.AuthUser, error) {
+	return rps.Primary.GetAuthUserByID(ctx, userID)
+}
+
+// UpdateAuthUser method sets refresh token in primary and secondary repository
+func (rps *DualWriteRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) error {
+	if err := rps.Primary.UpdateAuthUser(ctx, email, refreshToken); err != nil {
+		return err
+	}
+	rps.secondary(ctx, "update authUser", func(ctx context.Context) error {
+		return rps.Secondary.UpdateAuthUser(ctx, email, refreshToken)
+	})
+	return nil
+}
+
+// GetOrders method returns orders page from primary repository
+func (rps *DualWriteRepository) GetOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	return rps.Primary.GetOrders(ctx, afterID, limit)
+}
+
+// GetRecentOrders method returns recently updated orders page from primary
+// repository
+func (rps *DualWriteRepository) GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) ([]*model.Order, error) {
+	return rps.Primary.GetRecentOrders(ctx, beforeUpdatedAt, beforeID, limit)
+}
+
+// GetAuthUsers method returns users page from primary repository
+func (rps *DualWriteRepository) GetAuthUsers(ctx context.Context, afterID string, limit int) ([]*model.AuthUser, error) {
+	return rps.Primary.GetAuthUsers(ctx, afterID, limit)
+}
+
+// SaveTenant method saves tenant into primary and secondary repository
+func (rps *DualWriteRepository) SaveTenant(ctx context.Context, t *model.Tenant) error {
+	if err := rps.Primary.SaveTenant(ctx, t); err != nil {
+		return err
+	}
+	saved := *t
+	rps.secondary(ctx, "save tenant", func(ctx context.Context) error {
+		return rps.Secondary.SaveTenant(ctx, &saved)
+	})
+	return nil
+}
+
+// GetTenant method returns tenant from primary repository
+func (rps *DualWriteRepository) GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	return rps.Primary.GetTenant(ctx, tenantID)
+}
+
+// UpdateTenant method updates tenant in primary and secondary repository
+func (rps *DualWriteRepository) UpdateTenant(ctx context.Context, t *model.Tenant) error {
+	if err := rps.Primary.UpdateTenant(ctx, t); err != nil {
+		return err
+	}
+	updated := *t
+	rps.secondary(ctx, "update tenant", func(ctx context.Context) error {
+		return rps.Secondary.UpdateTenant(ctx, &updated)
+	})
+	return nil
+}
+
+// ArchiveOrders method archives orders in primary repository and then
+// moves exactly the orders primary archived in secondary one, so both
+// repositories archive the same orders even if their contents differ
+func (rps *DualWriteRepository) ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) ([]*model.Order, error) {
+	orders, err := rps.Primary.ArchiveOrders(ctx, deliveredBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	archived := make([]model.Order, len(orders))
+	for i, order := range orders {
+		archived[i] = *order
+	}
+	rps.secondary(ctx, "archive orders", func(ctx context.Context) error {
+		return rps.Secondary.WithinTransaction(ctx, func(ctx context.Context, tx Repository) error {
+			for i := range archived {
+				orderCtx := tenant.WithID(ctx, archived[i].TenantID)
+				if err := tx.SaveArchivedOrder(orderCtx, &archived[i]); err != nil {
+					return err
+				}
+				// order missing in secondary is already gone there
+				if err := tx.Delete(orderCtx, archived[i].OrderID); err != nil && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	return orders, nil
+}
+
+// GetArchivedOrder method returns archived order from primary repository
+func (rps *DualWriteRepository) GetArchivedOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	return rps.Primary.GetArchivedOrder(ctx, orderID)
+}
+
+// GetArchivedOrders method returns archived orders page from primary repository
+func (rps *DualWriteRepository) GetArchivedOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	return rps.Primary.GetArchivedOrders(ctx, afterID, limit)
+}
+
+// SaveArchivedOrder method saves archived order into primary and secondary repository
+func (rps *DualWriteRepository) SaveArchivedOrder(ctx context.Context, order *model.Order) error {
+	if err := rps.Primary.SaveArchivedOrder(ctx, order); err != nil {
+		return err
+	}
+	saved := *order
+	rps.secondary(ctx, "save archived order", func(ctx context.Context) error {
+		return rps.Secondary.SaveArchivedOrder(ctx, &saved)
+	})
+	return nil
+}
+
+// GetTenants method returns tenants page from primary repository
+func (rps *DualWriteRepository) GetTenants(ctx context.Context, afterID string, limit int) ([]*model.Tenant, error) {
+	return rps.Primary.GetTenants(ctx, afterID, limit)
+}
+
+// WithinTransaction method runs fn inside primary transaction. Secondary
+// writes made by fn are deferred until primary commits and dropped on rollback
+func (rps *DualWriteRepository) WithinTransaction(ctx context.Context, fn TxFunc) error {
+	if rps.pending != nil {
+		return fn(ctx, rps)
+	}
+	var pending []func(context.Context) error
+	err := rps.Primary.WithinTransaction(ctx, func(ctx context.Context, tx Repository) error {
+		pending = nil
+		return fn(ctx, &DualWriteRepository{Primary: tx, Secondary: rps.Secondary, pending: &pending})
+	})
+	if err != nil {
+		return err
+	}
+	for _, write := range pending {
+		rps.secondary(ctx, "apply transaction", write)
+	}
+	return nil
+}
+
+// CloseDBConnection closes both repositories
+func (rps *DualWriteRepository) CloseDBConnection() error {
+	if err := rps.Secondary.CloseDBConnection(); err != nil {
+		log.Errorf("dual write repository: can't close secondary repository - %e", err)
+	}
+	return rps.Primary.CloseDBConnection()
+}
+
+func (rps *DualWriteRepository) secondary(ctx context.Context, operation string, write func(context.Context) error) {
+	if rps.pending != nil {
+		*rps.pending = append(*rps.pending, write)
+		return
+	}
+	if err := write(ctx); err != nil {
+		log.WithFields(log.Fields{
+			"operation": operation,
+			"err":       err,
+		}).Error("dual write repository: secondary write failed")
+	}
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds which every repository implementation reports. Check them
+// with errors.Is
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrConflict    = errors.New("already exists")
+	ErrValidation  = errors.New("validation failed")
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// Error type attaches one of error kinds to underlying error, so callers
+// can match both the kind and driver specific error
+type Error struct {
+	Kind error
+	Err  error
+}
+
+// NewError returns Error of kind with message formatted like fmt.Errorf,
+// %w verb is supported
+func NewError(kind error, format string, a ...interface{}) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, a...)}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is kind of this error
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/metrics"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveArgs are arguments which are never written to slow query log
+var sensitiveArgs = map[string]bool{
+	"email":        true,
+	"password":     true,
+	"refreshToken": true,
+	"userName":     true,
+}
+
+// RepositoryMetrics type holds metric families shared by all instrumented
+// repositories
+type RepositoryMetrics struct {
+	duration *metrics.HistogramVec
+	errors   *metrics.CounterVec
+}
+
+// NewRepositoryMetrics registers repository metric families in reg
+func NewRepositoryMetrics(reg *metrics.Registry) *RepositoryMetrics {
+	return &RepositoryMetrics{
+		duration: reg.NewHistogramVec("crudserver_repository_duration_seconds",
+			"Repository call latency.", metrics.DefaultBuckets, "backend", "method"),
+		errors: reg.NewCounterVec("crudserver_repository_errors_total",
+			"Failed repository calls by error kind.", "backend", "method", "kind"),
+	}
+}
+
+// InstrumentedRepository type wraps repository to record latency and
+// errors of every call and to log calls slower than threshold
+type InstrumentedRepository struct {
+	next          Repository
+	backend       string
+	metrics       *RepositoryMetrics
+	slowThreshold time.Duration
+}
+
+// NewInstrumentedRepository returns repository which instruments next.
+// Zero slowThreshold disables slow query logging
+func NewInstrumentedRepository(next Repository, backend string, m *RepositoryMetrics, slowThreshold time.Duration) *InstrumentedRepository {
+	return &InstrumentedRepository{next: next, backend: backend, metrics: m, slowThreshold: slowThreshold}
+}
+
+// observe records call of method which started at start. args are pairs
+// of argument name and value, sensitive values are redacted before logging
+func (rps *InstrumentedRepository) observe(method string, start time.Time, err error, args ...interface{}) {
+	elapsed := time.Since(start)
+	rps.metrics.duration.With(rps.backend, method).Observe(elapsed.Seconds())
+	if err != nil {
+		rps.metrics.errors.With(rps.backend, method, errorKind(err)).Inc()
+	}
+	if rps.slowThreshold <= 0 || elapsed < rps.slowThreshold {
+		return
+	}
+	fields := log.Fields{
+		"backend":  rps.backend,
+		"method":   method,
+		"duration": elapsed,
+		"err":      err,
+	}
+	for i := 0; i+1 < len(args); i += 2 {
+		name, _ := args[i].(string)
+		if sensitiveArgs[name] {
+			fields["arg."+name] = redacted
+		} else {
+			fields["arg."+name] = args[i+1]
+		}
+	}
+	log.WithFields(fields).Warn("repository: slow query")
+}
+
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrValidation):
+		return "validation"
+	case errors.Is(err, ErrUnavailable):
+		return "unavailable"
+	default:
+		return "internal"
+	}
+}
+
+// Save method instruments Save call
+func (rps *InstrumentedRepository) Save(ctx context.Context, order *model.Order) (err error) {
+	defer func(start time.Time) {
+		rps.observe("Save", start, err, "orderID", order.OrderID)
+	}(time.Now())
+	return rps.next.Save(ctx, order)
+}
+
+// Get method instruments Get call
+func (rps *InstrumentedRepository) Get(ctx context.Context, orderID string) (order *model.Order, err error) {
+	defer func(start time.Time) {
+		rps.observe("Get", start, err, "orderID", orderID)
+	}(time.Now())
+	return rps.next.Get(ctx, orderID)
+}
+
+// Update method instruments Update call
+func (rps *InstrumentedRepository) Update(ctx context.Context, order *model.Order) (err error) {
+	defer func(start time.Time) {
+		rps.observe("Update", start, err, "orderID", order.OrderID)
+	}(time.Now())
+	return rps.next.Update(ctx, order)
+}
+
+// Delete method instruments Delete call
+func (rps *InstrumentedRepository) Delete(ctx context.Context, orderID string) (err error) {
+	defer func(start time.Time) {
+		rps.observe("Delete", start, err, "orderID", orderID)
+	}(time.Now())
+	return rps.next.Delete(ctx, orderID)
+}
+
+// SaveAuthUser method instruments SaveAuthUser call
+func (rps *InstrumentedRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) (err error) {
+	defer func(start time.Time) {
+		rps.observe("SaveAuthUser", start, err, "email", authUser.Email, "userName", authUser.UserName,
+			"password", authUser.Password)
+	}(time.Now())
+	return rps.next.SaveAuthUser(ctx, authUser)
+}
+
+// GetAuthUser method instruments GetAuthUser call
+func (rps *InstrumentedRepository) GetAuthUser(ctx context.Context, email string) (authUser *model.AuthUser, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetAuthUser", start, err, "email", email)
+	}(time.Now())
+	return rps.next.GetAuthUser(ctx, email)
+}
+
+// GetAuthUserByID method instruments GetAuthUserByID call
+func (rps *InstrumentedRepository) GetAuthUserByID(ctx context.Context, userID string) (authUser *model.AuthUser, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetAuthUserByID", start, err, "userID", userID)
+	}(time.Now())
+	return rps.next.GetAuthUserByID(ctx, userID)
+}
+
+// UpdateAuthUser method instruments UpdateAuthUser call
+func (rps *InstrumentedRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) (err error) {
+	defer func(start time.Time) {
+		rps.observe("UpdateAuthUser", start, err, "email", email, "refreshToken", refreshToken)
+	}(time.Now())
+	return rps.next.UpdateAuthUser(ctx, email, refreshToken)
+}
+
+// GetOrders method instruments GetOrders call
+func (rps *InstrumentedRepository) GetOrders(ctx context.Context, afterID string, limit int) (orders []*model.Order, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetOrders", start, err, "afterID", afterID, "limit", limit)
+	}(time.Now())
+	return rps.next.GetOrders(ctx, afterID, limit)
+}
+
+// GetRecentOrders method instruments GetRecentOrders call
+func (rps *InstrumentedRepository) GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) (orders []*model.Order, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetRecentOrders", start, err, "beforeUpdatedAt", beforeUpdatedAt, "beforeID", beforeID, "limit", limit)
+	}(time.Now())
+	return rps.next.GetRecentOrders(ctx, beforeUpdatedAt, beforeID, limit)
+}
+
+// GetAuthUsers method instruments GetAuthUsers call
+func (rps *InstrumentedRepository) GetAuthUsers(ctx context.Context, afterID string, limit int) (authUsers []*model.AuthUser, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetAuthUsers", start, err, "afterID", afterID, "limit", limit)
+	}(time.Now())
+	return rps.next.GetAuthUsers(ctx, afterID, limit)
+}
+
+// SaveTenant method instruments SaveTenant call
+func (rps *InstrumentedRepository) SaveTenant(ctx context.Context, t *model.Tenant) (err error) {
+	defer func(start time.Time) {
+		rps.observe("SaveTenant", start, err, "tenantID", t.TenantID)
+	}(time.Now())
+	return rps.next.SaveTenant(ctx, t)
+}
+
+// GetTenant method instruments GetTenant call
+func (rps *InstrumentedRepository) GetTenant(ctx context.Context, tenantID string) (t *model.Tenant, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetTenant", start, err, "tenantID", tenantID)
+	}(time.Now())
+	return rps.next.GetTenant(ctx, tenantID)
+}
+
+// UpdateTenant method instruments UpdateTenant call
+func (rps *InstrumentedRepository) UpdateTenant(ctx context.Context, t *model.Tenant) (err error) {
+	defer func(start time.Time) {
+		rps.observe("UpdateTenant", start, err, "tenantID", t.TenantID, "disabled", t.Disabled)
+	}(time.Now())
+	return rps.next.UpdateTenant(ctx, t)
+}
+
+// ArchiveOrders method instruments ArchiveOrders call
+func (rps *InstrumentedRepository) ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) (orders []*model.Order, err error) {
+	defer func(start time.Time) {
+		rps.observe("ArchiveOrders", start, err, "deliveredBefore", deliveredBefore, "limit", limit)
+	}(time.Now())
+	return rps.next.ArchiveOrders(ctx, deliveredBefore, limit)
+}
+
+// GetArchivedOrder method instruments GetArchivedOrder call
+func (rps *InstrumentedRepository) GetArchivedOrder(ctx context.Context, orderID string) (order *model.Order, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetArchivedOrder", start, err, "orderID", orderID)
+	}(time.Now())
+	return rps.next.GetArchivedOrder(ctx, orderID)
+}
+
+// GetArchivedOrders method instruments GetArchivedOrders call
+func (rps *InstrumentedRepository) GetArchivedOrders(ctx context.Context, afterID string, limit int) (orders []*model.Order, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetArchivedOrders", start, err, "afterID", afterID, "limit", limit)
+	}(time.Now())
+	return rps.next.GetArchivedOrders(ctx, afterID, limit)
+}
+
+// SaveArchivedOrder method instruments SaveArchivedOrder call
+func (rps *InstrumentedRepository) SaveArchivedOrder(ctx context.Context, order *model.Order) (err error) {
+	defer func(start time.Time) {
+		rps.observe("SaveArchivedOrder", start, err, "orderID", order.OrderID)
+	}(time.Now())
+	return rps.next.SaveArchivedOrder(ctx, order)
+}
+
+// GetTenants method instruments GetTenants call
+func (rps *InstrumentedRepository) GetTenants(ctx context.Context, afterID string, limit int) (tenants []*model.Tenant, err error) {
+	defer func(start time.Time) {
+		rps.observe("GetTenants", start, err, "afterID", afterID, "limit", limit)
+	}(time.Now())
+	return rps.next.GetTenants(ctx, afterID, limit)
+}
+
+// WithinTransaction method instruments whole transaction and every call
+// made inside it
+func (rps *InstrumentedRepository) WithinTransaction(ctx context.Context, fn TxFunc) (err error) {
+	defer func(start time.Time) {
+		rps.observe("WithinTransaction", start, err)
+	}(time.Now())
+	return rps.next.WithinTransaction(ctx, func(ctx context.Context, tx Repository) error {
+		return fn(ctx, &InstrumentedRepository{next: tx, backend: rps.backend, metrics: rps.metrics, slowThreshold: rps.slowThreshold})
+	})
+}
+
+// CloseDBConnection closes wrapped repository
+func (rps *InstrumentedRepository) CloseDBConnection() error {
+	return rps.next.CloseDBConnection()
+}
+
+// poolMetricsPrefix is name prefix of pgxpool metric families
+const poolMetricsPrefix = "crudserver_postgres_pool_"
+
+// RegisterPoolMetrics function exposes pgxpool statistics of pool in reg,
+// pool label tells primary and replica pools apart. Statistics are exposed
+// once per registry, repeated call returns error and registers nothing.
+// Cumulative statistics are exposed as counters
+func RegisterPoolMetrics(reg *metrics.Registry, pools map[string]*pgxpool.Pool) error {
+	type setter interface {
+		Set(fn func() float64, values ...string)
+	}
+	gauge := func(name, help string) setter { return reg.NewGaugeFuncVec(name, help, "pool") }
+	counter := func(name, help string) setter { return reg.NewCounterFuncVec(name, help, "pool") }
+	stats := []struct {
+		name     string
+		help     string
+		register func(name, help string) setter
+		value    func(*pgxpool.Stat) float64
+	}{
+		{"acquired_conns", "Connections currently acquired from pool.", gauge, func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) }},
+		{"idle_conns", "Idle connections in pool.", gauge, func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) }},
+		{"total_conns", "Total connections in pool.", gauge, func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) }},
+		{"max_conns", "Maximum size of pool.", gauge, func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) }},
+		{"acquires_total", "Successful acquires from pool.", counter, func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) }},
+		{"acquire_duration_seconds_total", "Total time spent acquiring connections.", counter, func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() }},
+		{"empty_acquires_total", "Acquires which waited for connection.", counter, func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) }},
+		{"canceled_acquires_total", "Acquires canceled by context.", counter, func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) }},
+	}
+	for _, stat := range stats {
+		if reg.Registered(poolMetricsPrefix + stat.name) {
+			return fmt.Errorf("repository: pool metrics are already registered")
+		}
+	}
+	for _, stat := range stats {
+		stat := stat
+		family := stat.register(poolMetricsPrefix+stat.name, stat.help)
+		for name, pool := range pools {
+			pool := pool
+			family.Set(func() float64 { return stat.value(pool.Stat()) }, name)
+		}
+	}
+	return nil
+}
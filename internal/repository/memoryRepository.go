@@ -0,0 +1,663 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// MemoryRepository type replies for storing data in process memory.
+// If snapshot path is set, data is loaded from this file on creation
+// and written back on CloseDBConnection
+type MemoryRepository struct {
+	snapshotPath string
+	// undo restores entries changed inside transaction, it is nil outside
+	// of transaction
+	undo      *[]func()
+	mutex     sync.RWMutex
+	orders    map[string]model.Order
+	authUsers map[string]model.AuthUser
+	tenants   map[string]model.Tenant
+	archive   map[string]model.Order
+}
+
+type memorySnapshot struct {
+	Orders    []model.Order    `json:"orders"`
+	AuthUsers []model.AuthUser `json:"authUsers"`
+	Tenants   []model.Tenant   `json:"tenants"`
+	Archive   []model.Order    `json:"archive"`
+}
+
+// NewMemoryRepository returns new in-memory repository instance. Empty
+// snapshotPath disables persistence
+func NewMemoryRepository(snapshotPath string) (*MemoryRepository, error) {
+	rps := &MemoryRepository{
+		snapshotPath: snapshotPath,
+		orders:       make(map[string]model.Order),
+		authUsers:    make(map[string]model.AuthUser),
+		archive:      make(map[string]model.Order),
+		tenants: map[string]model.Tenant{
+			tenant.DefaultID: {TenantID: tenant.DefaultID, Name: tenant.DefaultID},
+		},
+	}
+	if snapshotPath == "" {
+		return rps, nil
+	}
+	if err := rps.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	return rps, nil
+}
+
+// Save method saves Order object into memory
+func (rps *MemoryRepository) Save(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID":   order.OrderID,
+		"orderName": order.OrderName,
+	}).Debugf("memory repository: save order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	if _, found := rps.orders[order.OrderID]; found {
+		return NewError(ErrConflict, "memory repository: can't save order - order %s already exists", order.OrderID)
+	}
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	rps.keepOrder(rps.orders, order.OrderID)
+	rps.orders[order.OrderID] = *order
+	return nil
+}
+
+// Get method returns Order object from memory with selection by OrderID
+func (rps *MemoryRepository) Get(ctx context.Context, orderID string) (*model.Order, error) {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("memory repository: get order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	order, found := rps.orders[orderID]
+	if !found || !visible(scope, order.TenantID) {
+		return nil, NewError(ErrNotFound, "memory repository: can't get order - order %s not found", orderID)
+	}
+	return &order, nil
+}
+
+// Update method updates Order object in memory with selection by OrderID
+func (rps *MemoryRepository) Update(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID":   order.OrderID,
+		"orderName": order.OrderName,
+	}).Debugf("memory repository: update order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	stored, found := rps.orders[order.OrderID]
+	if !found || !visible(scope, stored.TenantID) {
+		return NewError(ErrNotFound, "memory repository: can't update order - order %s not found", order.OrderID)
+	}
+	updated := *order
+	updated.TenantID = stored.TenantID
+	rps.keepOrder(rps.orders, order.OrderID)
+	rps.orders[order.OrderID] = updated
+	return nil
+}
+
+// Delete method deletes Order object from memory with selection by OrderID
+func (rps *MemoryRepository) Delete(ctx context.Context, orderID string) error {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("memory repository: delete order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	if stored, found := rps.orders[orderID]; !found || !visible(scope, stored.TenantID) {
+		return NewError(ErrNotFound, "memory repository: can't delete order - order %s not found", orderID)
+	}
+	rps.keepOrder(rps.orders, orderID)
+	delete(rps.orders, orderID)
+	return nil
+}
+
+// SaveAuthUser method saves authentication info about user into memory
+func (rps *MemoryRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) error {
+	log.WithFields(log.Fields{
+		"userID":   authUser.UserUUID,
+		"userName": authUser.UserName,
+	}).Debugf("memory repository: save authUser")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	if _, found := rps.authUsers[authUser.Email]; found {
+		return NewError(ErrConflict, "memory repository: can't save authUser - email %s already exists", authUser.Email)
+	}
+	if authUser.UserUUID == "" {
+		authUser.UserUUID = uuid.New().String()
+	}
+	authUser.TenantID = ownerTenant(scope, authUser.TenantID)
+	rps.keepAuthUser(authUser.Email)
+	rps.authUsers[authUser.Email] = *authUser
+	return nil
+}
+
+// GetAuthUser method returns authentication info about user from
+// memory with selection by email
+func (rps *MemoryRepository) GetAuthUser(ctx context.Context, email string) (*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"email": email,
+	}).Debugf("memory repository: get authUser by email")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	authUser, found := rps.authUsers[email]
+	if !found || !visible(scope, authUser.TenantID) {
+		return nil, NewError(ErrNotFound, "memory repository: can't get authUser - email %s not found", email)
+	}
+	return &authUser, nil
+}
+
+// GetAuthUserByID method returns authentication info about user from
+// memory with selection by id
+func (rps *MemoryRepository) GetAuthUserByID(ctx context.Context, userUUID string) (*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("memory repository: get authUser by id")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	for _, authUser := range rps.authUsers {
+		if authUser.UserUUID == userUUID && visible(scope, authUser.TenantID) {
+			return &authUser, nil
+		}
+	}
+	return nil, NewError(ErrNotFound, "memory repository: can't get authUser by ID - user %s not found", userUUID)
+}
+
+// UpdateAuthUser is method to set refresh token into authuser info
+func (rps *MemoryRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) error {
+	log.WithFields(log.Fields{
+		"email": email,
+	}).Debugf("memory repository: update authUser")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	authUser, found := rps.authUsers[email]
+	if !found || !visible(scope, authUser.TenantID) {
+		return NewError(ErrNotFound, "memory repository: can't update authUser - email %s not found", email)
+	}
+	authUser.RefreshToken = refreshToken
+	rps.keepAuthUser(email)
+	rps.authUsers[email] = authUser
+	return nil
+}
+
+// GetOrders method returns up to limit orders with OrderID greater than
+// afterID ordered by OrderID, so orders can be read page by page
+func (rps *MemoryRepository) GetOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("memory repository: get orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	ids := make([]string, 0, len(rps.orders))
+	for orderID, order := range rps.orders {
+		if orderID > afterID && visible(scope, order.TenantID) {
+			ids = append(ids, orderID)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	orders := make([]*model.Order, 0, len(ids))
+	for _, orderID := range ids {
+		order := rps.orders[orderID]
+		orders = append(orders, &order)
+	}
+	return orders, nil
+}
+
+// GetRecentOrders method returns up to limit orders updated before order
+// identified by beforeUpdatedAt and beforeID, most recently updated first.
+// Empty beforeID starts from the most recently updated order
+func (rps *MemoryRepository) GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"beforeUpdatedAt": beforeUpdatedAt,
+		"beforeID":        beforeID,
+		"limit":           limit,
+	}).Debugf("memory repository: get recent orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	orders := make([]*model.Order, 0, len(rps.orders))
+	for orderID, order := range rps.orders {
+		before := beforeID == "" || order.UpdatedAt < beforeUpdatedAt || (order.UpdatedAt == beforeUpdatedAt && orderID < beforeID)
+		if before && visible(scope, order.TenantID) {
+			order := order
+			orders = append(orders, &order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].UpdatedAt != orders[j].UpdatedAt {
+			return orders[i].UpdatedAt > orders[j].UpdatedAt
+		}
+		return orders[i].OrderID > orders[j].OrderID
+	})
+	if len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+}
+
+// GetAuthUsers method returns up to limit users with UserUUID greater than
+// afterID ordered by UserUUID
+func (rps *MemoryRepository) GetAuthUsers(ctx context.Context, afterID string, limit int) ([]*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("memory repository: get authUsers")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	authUsers := make([]*model.AuthUser, 0, len(rps.authUsers))
+	for _, authUser := range rps.authUsers {
+		if authUser.UserUUID > afterID && visible(scope, authUser.TenantID) {
+			authUser := authUser
+			authUsers = append(authUsers, &authUser)
+		}
+	}
+	sort.Slice(authUsers, func(i, j int) bool {
+		return authUsers[i].UserUUID < authUsers[j].UserUUID
+	})
+	if len(authUsers) > limit {
+		authUsers = authUsers[:limit]
+	}
+	return authUsers, nil
+}
+
+// SaveTenant method saves tenant into memory
+func (rps *MemoryRepository) SaveTenant(ctx context.Context, t *model.Tenant) error {
+	log.WithFields(log.Fields{
+		"tenantID": t.TenantID,
+	}).Debugf("memory repository: save tenant")
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	if _, found := rps.tenants[t.TenantID]; found {
+		return NewError(ErrConflict, "memory repository: can't save tenant - tenant %s already exists", t.TenantID)
+	}
+	rps.keepTenant(t.TenantID)
+	rps.tenants[t.TenantID] = *t
+	return nil
+}
+
+// GetTenant method returns tenant from memory with selection by id
+func (rps *MemoryRepository) GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	log.WithFields(log.Fields{
+		"tenantID": tenantID,
+	}).Debugf("memory repository: get tenant")
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	t, found := rps.tenants[tenantID]
+	if !found {
+		return nil, NewError(ErrNotFound, "memory repository: can't get tenant - tenant %s not found", tenantID)
+	}
+	return &t, nil
+}
+
+// UpdateTenant method updates tenant name and state in memory
+func (rps *MemoryRepository) UpdateTenant(ctx context.Context, t *model.Tenant) error {
+	log.WithFields(log.Fields{
+		"tenantID": t.TenantID,
+		"disabled": t.Disabled,
+	}).Debugf("memory repository: update tenant")
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	if _, found := rps.tenants[t.TenantID]; !found {
+		return NewError(ErrNotFound, "memory repository: can't update tenant - tenant %s not found", t.TenantID)
+	}
+	rps.keepTenant(t.TenantID)
+	rps.tenants[t.TenantID] = *t
+	return nil
+}
+
+// ArchiveOrders method moves up to limit orders delivered before
+// deliveredBefore unix time into archive and returns moved orders
+func (rps *MemoryRepository) ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"deliveredBefore": deliveredBefore,
+		"limit":           limit,
+	}).Debugf("memory repository: archive orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	orderIDs := make([]string, 0)
+	for orderID, order := range rps.orders {
+		if order.IsDelivered && order.DeliveredAt > 0 && order.DeliveredAt < deliveredBefore && visible(scope, order.TenantID) {
+			orderIDs = append(orderIDs, orderID)
+		}
+	}
+	sort.Strings(orderIDs)
+	if len(orderIDs) > limit {
+		orderIDs = orderIDs[:limit]
+	}
+	orders := make([]*model.Order, 0, len(orderIDs))
+	for _, orderID := range orderIDs {
+		order := rps.orders[orderID]
+		rps.keepOrder(rps.archive, orderID)
+		rps.keepOrder(rps.orders, orderID)
+		rps.archive[orderID] = order
+		delete(rps.orders, orderID)
+		orders = append(orders, &order)
+	}
+	return orders, nil
+}
+
+// GetArchivedOrder method returns Order object from archive with
+// selection by OrderID
+func (rps *MemoryRepository) GetArchivedOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("memory repository: get archived order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	order, found := rps.archive[orderID]
+	if !found || !visible(scope, order.TenantID) {
+		return nil, NewError(ErrNotFound, "memory repository: can't get archived order - order %s not found", orderID)
+	}
+	return &order, nil
+}
+
+// GetArchivedOrders method returns up to limit archived orders with OrderID
+// greater than afterID ordered by OrderID
+func (rps *MemoryRepository) GetArchivedOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("memory repository: get archived orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	ids := make([]string, 0, len(rps.archive))
+	for orderID, order := range rps.archive {
+		if orderID > afterID && visible(scope, order.TenantID) {
+			ids = append(ids, orderID)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	orders := make([]*model.Order, 0, len(ids))
+	for _, orderID := range ids {
+		order := rps.archive[orderID]
+		orders = append(orders, &order)
+	}
+	return orders, nil
+}
+
+// SaveArchivedOrder method saves order into archive, archived order with
+// the same OrderID is replaced
+func (rps *MemoryRepository) SaveArchivedOrder(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID": order.OrderID,
+	}).Debugf("memory repository: save archived order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	rps.keepOrder(rps.archive, order.OrderID)
+	rps.archive[order.OrderID] = *order
+	return nil
+}
+
+// GetTenants method returns up to limit tenants with TenantID greater than
+// afterID ordered by TenantID
+func (rps *MemoryRepository) GetTenants(ctx context.Context, afterID string, limit int) ([]*model.Tenant, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("memory repository: get tenants")
+	rps.mutex.RLock()
+	defer rps.mutex.RUnlock()
+	ids := make([]string, 0, len(rps.tenants))
+	for tenantID := range rps.tenants {
+		if tenantID > afterID {
+			ids = append(ids, tenantID)
+		}
+	}
+	sort.Strings(ids)
+	if len(ids) > limit {
+		ids = ids[:limit]
+	}
+	tenants := make([]*model.Tenant, 0, len(ids))
+	for _, tenantID := range ids {
+		t := rps.tenants[tenantID]
+		tenants = append(tenants, &t)
+	}
+	return tenants, nil
+}
+
+// WithinTransaction method runs fn while holding write lock. Calls made
+// through repository passed to fn change data in place and remember
+// previous state of every entry they touch, which is restored unless fn
+// returns nil, so error or panic leaves data untouched. fn must not use
+// repository it was called on
+func (rps *MemoryRepository) WithinTransaction(ctx context.Context, fn TxFunc) error {
+	if rps.undo != nil {
+		return fn(ctx, rps)
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	tx := &MemoryRepository{
+		undo:      &[]func(){},
+		orders:    rps.orders,
+		authUsers: rps.authUsers,
+		tenants:   rps.tenants,
+		archive:   rps.archive,
+	}
+	committed := false
+	defer func() {
+		if committed {
+			return
+		}
+		undo := *tx.undo
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}()
+	if err := fn(ctx, tx); err != nil {
+		return err
+	}
+	committed = true
+	return nil
+}
+
+// keepOrder remembers state of order in orders or archive before it is
+// changed inside transaction
+func (rps *MemoryRepository) keepOrder(orders map[string]model.Order, orderID string) {
+	if rps.undo == nil {
+		return
+	}
+	order, found := orders[orderID]
+	*rps.undo = append(*rps.undo, func() {
+		if found {
+			orders[orderID] = order
+		} else {
+			delete(orders, orderID)
+		}
+	})
+}
+
+// keepAuthUser remembers state of user before it is changed inside
+// transaction
+func (rps *MemoryRepository) keepAuthUser(email string) {
+	if rps.undo == nil {
+		return
+	}
+	authUser, found := rps.authUsers[email]
+	*rps.undo = append(*rps.undo, func() {
+		if found {
+			rps.authUsers[email] = authUser
+		} else {
+			delete(rps.authUsers, email)
+		}
+	})
+}
+
+// keepTenant remembers state of tenant before it is changed inside
+// transaction
+func (rps *MemoryRepository) keepTenant(tenantID string) {
+	if rps.undo == nil {
+		return
+	}
+	t, found := rps.tenants[tenantID]
+	*rps.undo = append(*rps.undo, func() {
+		if found {
+			rps.tenants[tenantID] = t
+		} else {
+			delete(rps.tenants, tenantID)
+		}
+	})
+}
+
+// CloseDBConnection writes snapshot file if persistence is enabled
+func (rps *MemoryRepository) CloseDBConnection() error {
+	if rps.snapshotPath == "" {
+		return nil
+	}
+	return rps.saveSnapshot()
+}
+
+func (rps *MemoryRepository) loadSnapshot() error {
+	data, err := os.ReadFile(rps.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("memory repository: can't read snapshot - %w", err)
+	}
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("memory repository: can't parse snapshot - %w", err)
+	}
+	rps.mutex.Lock()
+	defer rps.mutex.Unlock()
+	for _, order := range snapshot.Orders {
+		rps.orders[order.OrderID] = order
+	}
+	for _, authUser := range snapshot.AuthUsers {
+		rps.authUsers[authUser.Email] = authUser
+	}
+	for _, t := range snapshot.Tenants {
+		rps.tenants[t.TenantID] = t
+	}
+	for _, order := range snapshot.Archive {
+		rps.archive[order.OrderID] = order
+	}
+	log.WithFields(log.Fields{
+		"orders":    len(snapshot.Orders),
+		"authUsers": len(snapshot.AuthUsers),
+	}).Info("memory repository: snapshot loaded")
+	return nil
+}
+
+func (rps *MemoryRepository) saveSnapshot() error {
+	rps.mutex.RLock()
+	snapshot := memorySnapshot{
+		Orders:    make([]model.Order, 0, len(rps.orders)),
+		AuthUsers: make([]model.AuthUser, 0, len(rps.authUsers)),
+		Tenants:   make([]model.Tenant, 0, len(rps.tenants)),
+		Archive:   make([]model.Order, 0, len(rps.archive)),
+	}
+	for _, order := range rps.orders {
+		snapshot.Orders = append(snapshot.Orders, order)
+	}
+	for _, authUser := range rps.authUsers {
+		snapshot.AuthUsers = append(snapshot.AuthUsers, authUser)
+	}
+	for _, t := range rps.tenants {
+		snapshot.Tenants = append(snapshot.Tenants, t)
+	}
+	for _, order := range rps.archive {
+		snapshot.Archive = append(snapshot.Archive, order)
+	}
+	rps.mutex.RUnlock()
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("memory repository: can't encode snapshot - %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(rps.snapshotPath), filepath.Base(rps.snapshotPath)+".*")
+	if err != nil {
+		return fmt.Errorf("memory repository: can't write snapshot - %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("memory repository: can't write snapshot - %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("memory repository: can't write snapshot - %w", err)
+	}
+	if err := os.Rename(tmp.Name(), rps.snapshotPath); err != nil {
+		return fmt.Errorf("memory repository: can't write snapshot - %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package repository_test
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/repository/repotest"
+	"testing"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		rps, err := repository.NewMemoryRepository("")
+		if err != nil {
+			t.Fatalf("can't create memory repository - %v", err)
+		}
+		return rps
+	})
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// migrationFiles stores sql migrations shared by sql repositories
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	migrationsTable = `create table if not exists schema_migrations (version text primary key)`
+)
+
+type migration struct {
+	version string
+	query   string
+}
+
+// loadMigrations returns embedded migrations of dialect sorted by version.
+// Migration named <version>.<dialect>.sql is applied only to that dialect,
+// <version>.sql is applied to all of them
+func loadMigrations(dialect string) ([]migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("repository: can't read migrations - %w", err)
+	}
+	migrations := make([]migration, 0, len(entries))
+	for _, entry := range entries {
+		version := strings.TrimSuffix(entry.Name(), ".sql")
+		if ext := path.Ext(version); ext != "" {
+			if ext != "."+dialect {
+				continue
+			}
+			version = strings.TrimSuffix(version, ext)
+		}
+		query, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("repository: can't read migration %s - %w", entry.Name(), err)
+		}
+		migrations = append(migrations, migration{
+			version: version,
+			query:   string(query),
+		})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
@@ -0,0 +1,14 @@
+create table if not exists orders (
+    orderID text primary key,
+    orderName text not null,
+    orderCost integer not null,
+    isDelivered boolean not null default false
+);
+
+create table if not exists authusers (
+    useruuid text primary key,
+    username text not null,
+    email text not null unique,
+    password text not null,
+    refreshtoken text not null default ''
+);
@@ -0,0 +1,11 @@
+create table if not exists tenants (
+    tenantid text primary key,
+    name text not null,
+    disabled boolean not null default false
+);
+
+insert into tenants (tenantid, name) values ('default', 'default');
+
+alter table orders add column tenantid text not null default 'default';
+
+alter table authusers add column tenantid text not null default 'default';
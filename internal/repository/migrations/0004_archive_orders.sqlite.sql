@@ -0,0 +1,15 @@
+alter table orders add column deliveredat integer not null default 0;
+
+-- orders delivered before delivery time was tracked start aging now
+update orders set deliveredat = cast(strftime('%s', 'now') as integer) where isdelivered;
+
+create index if not exists orders_delivered_idx on orders (deliveredat) where isdelivered;
+
+create table if not exists archived_orders (
+    orderID text primary key,
+    orderName text not null,
+    orderCost integer not null,
+    isDelivered boolean not null,
+    tenantid text not null,
+    deliveredat integer not null
+);
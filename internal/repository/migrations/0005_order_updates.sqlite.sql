@@ -0,0 +1,5 @@
+alter table orders add column updatedat integer not null default 0;
+
+alter table archived_orders add column updatedat integer not null default 0;
+
+create index if not exists orders_updated_idx on orders (updatedat desc, orderID desc);
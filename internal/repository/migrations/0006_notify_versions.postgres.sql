@@ -0,0 +1,41 @@
+-- notifications carry version of change, so delayed notification can't
+-- overwrite newer state in caches. Version is updatedat of order, deletion
+-- is newer than last state of deleted order
+create or replace function notify_orders_change() returns trigger as $$
+declare
+    payload text;
+begin
+    if tg_op = 'DELETE' then
+        perform pg_notify('orders_changes', json_build_object(
+            'method', 'delete',
+            'version', old.updatedat + 1,
+            'order', json_build_object('orderID', old.orderid, 'tenantID', old.tenantid)
+        )::text);
+        return old;
+    end if;
+    payload := json_build_object(
+        'method', case tg_op when 'INSERT' then 'save' else 'update' end,
+        'version', new.updatedat,
+        'order', json_build_object(
+            'orderID', new.orderid,
+            'orderName', new.ordername,
+            'orderCost', new.ordercost,
+            'isDelivered', new.isdelivered,
+            'tenantID', new.tenantid,
+            'deliveredAt', new.deliveredat,
+            'updatedAt', new.updatedat
+        )
+    )::text;
+    -- notification payload is limited to 8000 bytes, too big order is
+    -- evicted from caches instead
+    if octet_length(payload) > 7900 then
+        payload := json_build_object(
+            'method', 'delete',
+            'version', new.updatedat,
+            'order', json_build_object('orderID', new.orderid, 'tenantID', new.tenantid)
+        )::text;
+    end if;
+    perform pg_notify('orders_changes', payload);
+    return new;
+end;
+$$ language plpgsql;
@@ -2,81 +2,138 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
 	"time"
 
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
-	timeout = 10
+	timeout             = 10
+	mongoDatabase       = "crudserver"
+	ordersCollection    = "orders"
+	authUsersCollection = "authusers"
+	tenantsCollection   = "tenants"
+	archiveCollection   = "archivedorders"
 )
 
-// MongoRepository type replies for accessing to mongo database
+// MongoRepository type replies for accessing to mongo database.
+// WithoutTransactions is set for deployment which can't run transactions
 type MongoRepository struct {
-	DBconn *mongo.Client
+	DBconn              *mongo.Client
+	WithoutTransactions bool
 }
 
-// Create method saves User object into mongo database
+func (rps MongoRepository) orders() *mongo.Collection {
+	return rps.DBconn.Database(mongoDatabase).Collection(ordersCollection)
+}
+
+// OrdersCollection returns collection which stores orders, it is used to
+// watch changes of orders
+func (rps MongoRepository) OrdersCollection() *mongo.Collection {
+	return rps.orders()
+}
+
+func (rps MongoRepository) authUsers() *mongo.Collection {
+	return rps.DBconn.Database(mongoDatabase).Collection(authUsersCollection)
+}
+
+func (rps MongoRepository) archive() *mongo.Collection {
+	return rps.DBconn.Database(mongoDatabase).Collection(archiveCollection)
+}
+
+func (rps MongoRepository) tenants() *mongo.Collection {
+	return rps.DBconn.Database(mongoDatabase).Collection(tenantsCollection)
+}
+
+// scoped appends tenant condition to filter unless scope is all tenants
+func scoped(scope string, filter bson.D) bson.D {
+	if scope != "" {
+		return append(filter, bson.E{Key: "tenantID", Value: scope})
+	}
+	return filter
+}
+
+// Save method saves Order object into mongo database
 func (rps MongoRepository) Save(ctx context.Context, order *model.Order) error {
-	col := rps.DBconn.Database("crudserver").Collection("users")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
 	defer cancel()
-	_, err := col.InsertOne(ctx, bson.D{
-		{Key: "_id", Value: uuid.New().String()},
-		{Key: "userName", Value: order.OrderName},
-		{Key: "userAge", Value: order.OrderCost},
-		{Key: "isAdult", Value: order.IsDelivered},
-	})
-	if err != nil {
-		return fmt.Errorf("mongo repository: can't save order - %w", err)
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	if _, err := rps.orders().InsertOne(ctx, order); err != nil {
+		return mongoError("can't save order", err)
 	}
 	return nil
 }
 
-// Read method returns User object from mongo database
-// with selection by UserId
+// Get method returns Order object from mongo database
+// with selection by OrderID
 func (rps MongoRepository) Get(ctx context.Context, orderID string) (*model.Order, error) {
-	col := rps.DBconn.Database("crudserver").Collection("users")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
 	defer cancel()
 	var order model.Order
-	err := col.FindOne(ctx, bson.D{{Key: "_id", Value: orderID}}).Decode(&order)
+	err = rps.orders().FindOne(ctx, scoped(scope, bson.D{{Key: "_id", Value: orderID}})).Decode(&order)
 	if err != nil {
-		return nil, fmt.Errorf("mongo repository: can't get order - %w", err)
+		return nil, mongoError("can't get order", err)
 	}
 	return &order, nil
 }
 
-// Update method updates User object from mongo database
-// with selection by UserId
+// Update method updates Order object from mongo database
+// with selection by OrderID
 func (rps MongoRepository) Update(ctx context.Context, order *model.Order) error {
-	col := rps.DBconn.Database("crudserver").Collection("users")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
 	defer cancel()
-	_, err := col.UpdateOne(ctx, bson.D{{Key: "_id", Value: order.OrderID}}, bson.D{
-		{Key: "userName", Value: order.OrderName},
-		{Key: "userAge", Value: order.OrderCost},
-		{Key: "isAdult", Value: order.IsDelivered},
+	result, err := rps.orders().UpdateOne(ctx, scoped(scope, bson.D{{Key: "_id", Value: order.OrderID}}), bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "orderName", Value: order.OrderName},
+			{Key: "orderCost", Value: order.OrderCost},
+			{Key: "isDelivered", Value: order.IsDelivered},
+			{Key: "deliveredAt", Value: order.DeliveredAt},
+			{Key: "updatedAt", Value: order.UpdatedAt},
+		}},
 	})
 	if err != nil {
-		return fmt.Errorf("mongo repository: can't update order - %w", err)
+		return mongoError("can't update order", err)
+	}
+	if result.MatchedCount == 0 {
+		return NewError(ErrNotFound, "mongo repository: can't update order - order %s not found", order.OrderID)
 	}
 	return nil
 }
 
-// Delete method deletes User object from mongo database
-// with selection by UserId
+// Delete method deletes Order object from mongo database
+// with selection by OrderID
 func (rps MongoRepository) Delete(ctx context.Context, orderID string) error {
-	col := rps.DBconn.Database("crudserver").Collection("users")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
 	defer cancel()
-	_, err := col.DeleteOne(ctx, bson.D{{Key: "_id", Value: orderID}})
+	result, err := rps.orders().DeleteOne(ctx, scoped(scope, bson.D{{Key: "_id", Value: orderID}}))
 	if err != nil {
-		return fmt.Errorf("mongo repository: can't delete order - %w", err)
+		return mongoError("can't delete order", err)
+	}
+	if result.DeletedCount == 0 {
+		return NewError(ErrNotFound, "mongo repository: can't delete order - order %s not found", orderID)
 	}
 	return nil
 }
@@ -84,41 +141,405 @@ func (rps MongoRepository) Delete(ctx context.Context, orderID string) error {
 // GetAuthUser method returns authentication info about user from
 // mongo database with selection by email
 func (rps MongoRepository) GetAuthUser(ctx context.Context, email string) (*model.AuthUser, error) {
-	return nil, nil
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var authUser model.AuthUser
+	err = rps.authUsers().FindOne(ctx, scoped(scope, bson.D{{Key: "email", Value: email}})).Decode(&authUser)
+	if err != nil {
+		return nil, mongoError("can't get authUser", err)
+	}
+	return &authUser, nil
 }
 
 // GetAuthUserByID method returns authentication info about user from
 // mongo database with selection by ID
 func (rps MongoRepository) GetAuthUserByID(ctx context.Context, userID string) (*model.AuthUser, error) {
-	return nil, nil
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var authUser model.AuthUser
+	err = rps.authUsers().FindOne(ctx, scoped(scope, bson.D{{Key: "_id", Value: userID}})).Decode(&authUser)
+	if err != nil {
+		return nil, mongoError("can't get authUser by ID", err)
+	}
+	return &authUser, nil
 }
 
-// CreateAuthUser method saves authentication info about user into
-// postgres database
+// SaveAuthUser method saves authentication info about user into
+// mongo database
 func (rps MongoRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) error {
-	col := rps.DBconn.Database("crudserver").Collection("authusers")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
 	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
 	defer cancel()
+	if authUser.UserUUID == "" {
+		authUser.UserUUID = uuid.New().String()
+	}
+	authUser.TenantID = ownerTenant(scope, authUser.TenantID)
+	if _, err := rps.authUsers().InsertOne(ctx, authUser); err != nil {
+		return mongoError("can't save authUser", err)
+	}
+	return nil
+}
 
-	_, err := col.InsertOne(ctx, bson.D{
-		{Key: "email", Value: authUser.Email},
-		{Key: "password", Value: authUser.Password},
+// UpdateAuthUser method changes user refresh token
+func (rps MongoRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) error {
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	result, err := rps.authUsers().UpdateOne(ctx, scoped(scope, bson.D{{Key: "email", Value: email}}), bson.D{
+		{Key: "$set", Value: bson.D{{Key: "refreshToken", Value: refreshToken}}},
 	})
 	if err != nil {
-		return fmt.Errorf("mongo repository: can't save authUser - %w", err)
+		return mongoError("can't update authUser", err)
+	}
+	if result.MatchedCount == 0 {
+		return NewError(ErrNotFound, "mongo repository: can't update authUser - email %s not found", email)
 	}
 	return nil
 }
 
-// UpdateAuthUser method changes user refresh token
-func (rps MongoRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) error {
+// GetOrders method returns up to limit orders with OrderID greater than
+// afterID ordered by OrderID, so orders can be read page by page
+func (rps MongoRepository) GetOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var orders []*model.Order
+	if err := findPage(ctx, rps.orders(), afterID, limit, &orders); err != nil {
+		return nil, mongoError("can't get orders", err)
+	}
+	return orders, nil
+}
+
+// GetRecentOrders method returns up to limit orders updated before order
+// identified by beforeUpdatedAt and beforeID, most recently updated first.
+// Empty beforeID starts from the most recently updated order
+func (rps MongoRepository) GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) ([]*model.Order, error) {
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	filter := bson.D{}
+	if beforeID != "" {
+		filter = bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "updatedAt", Value: bson.D{{Key: "$lt", Value: beforeUpdatedAt}}}},
+			bson.D{{Key: "updatedAt", Value: beforeUpdatedAt}, {Key: "_id", Value: bson.D{{Key: "$lt", Value: beforeID}}}},
+		}}}
+	}
+	cursor, err := rps.orders().Find(ctx, scoped(scope, filter),
+		options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, mongoError("can't get recent orders", err)
+	}
+	var orders []*model.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, mongoError("can't get recent orders", err)
+	}
+	return orders, nil
+}
+
+// GetAuthUsers method returns up to limit users with UserUUID greater than
+// afterID ordered by UserUUID
+func (rps MongoRepository) GetAuthUsers(ctx context.Context, afterID string, limit int) ([]*model.AuthUser, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var authUsers []*model.AuthUser
+	if err := findPage(ctx, rps.authUsers(), afterID, limit, &authUsers); err != nil {
+		return nil, mongoError("can't get authUsers", err)
+	}
+	return authUsers, nil
+}
+
+// findPage decodes into result up to limit documents with _id greater
+// than afterID ordered by _id
+func findPage(ctx context.Context, col *mongo.Collection, afterID string, limit int, result interface{}) error {
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	cursor, err := col.Find(ctx, scoped(scope, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: afterID}}}}),
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
+
+// Migrate method creates indexes which mongo repository relies on
+func (rps MongoRepository) Migrate(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	_, err := rps.authUsers().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return mongoError("can't create authUser email index", err)
+	}
+	_, err = rps.tenants().UpdateOne(ctx, bson.D{{Key: "_id", Value: tenant.DefaultID}}, bson.D{
+		{Key: "$setOnInsert", Value: model.Tenant{TenantID: tenant.DefaultID, Name: tenant.DefaultID}},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return mongoError("can't create default tenant", err)
+	}
+	_, err = rps.orders().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "isDelivered", Value: 1}, {Key: "deliveredAt", Value: 1}},
+	})
+	if err != nil {
+		return mongoError("can't create order delivery index", err)
+	}
+	_, err = rps.orders().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		return mongoError("can't create order update index", err)
+	}
+	// orders saved before update time was tracked are the least recent ones
+	_, err = rps.orders().UpdateMany(ctx, bson.D{
+		{Key: "updatedAt", Value: bson.D{{Key: "$exists", Value: false}}},
+	}, bson.D{{Key: "$set", Value: bson.D{{Key: "updatedAt", Value: 0}}}})
+	if err != nil {
+		return mongoError("can't set order update time", err)
+	}
+	// orders delivered before delivery time was tracked start aging now
+	_, err = rps.orders().UpdateMany(ctx, bson.D{
+		{Key: "isDelivered", Value: true},
+		{Key: "deliveredAt", Value: bson.D{{Key: "$exists", Value: false}}},
+	}, bson.D{{Key: "$set", Value: bson.D{{Key: "deliveredAt", Value: time.Now().Unix()}}}})
+	if err != nil {
+		return mongoError("can't set order delivery time", err)
+	}
+	return nil
+}
+
+// SaveTenant method saves tenant into mongo database
+func (rps MongoRepository) SaveTenant(ctx context.Context, t *model.Tenant) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	if _, err := rps.tenants().InsertOne(ctx, t); err != nil {
+		return mongoError("can't save tenant", err)
+	}
+	return nil
+}
+
+// GetTenant method returns tenant from mongo database with selection by id
+func (rps MongoRepository) GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var t model.Tenant
+	if err := rps.tenants().FindOne(ctx, bson.D{{Key: "_id", Value: tenantID}}).Decode(&t); err != nil {
+		return nil, mongoError("can't get tenant", err)
+	}
+	return &t, nil
+}
+
+// UpdateTenant method updates tenant name and state in mongo database
+func (rps MongoRepository) UpdateTenant(ctx context.Context, t *model.Tenant) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	result, err := rps.tenants().UpdateOne(ctx, bson.D{{Key: "_id", Value: t.TenantID}}, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "name", Value: t.Name},
+			{Key: "disabled", Value: t.Disabled},
+		}},
+	})
+	if err != nil {
+		return mongoError("can't update tenant", err)
+	}
+	if result.MatchedCount == 0 {
+		return NewError(ErrNotFound, "mongo repository: can't update tenant - tenant %s not found", t.TenantID)
+	}
+	return nil
+}
+
+// ArchiveOrders method moves up to limit orders delivered before
+// deliveredBefore unix time from orders to archive collection and returns
+// moved orders. Order is copied before it is removed, so interrupted call
+// can be safely repeated, and it is removed only if it wasn't changed since
+// it was copied
+func (rps MongoRepository) ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) ([]*model.Order, error) {
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	cursor, err := rps.orders().Find(ctx, scoped(scope, bson.D{
+		{Key: "isDelivered", Value: true},
+		{Key: "deliveredAt", Value: bson.D{{Key: "$gt", Value: 0}, {Key: "$lt", Value: deliveredBefore}}},
+	}), options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, mongoError("can't archive orders", err)
+	}
+	var orders []*model.Order
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, mongoError("can't archive orders", err)
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	moved := make([]*model.Order, 0, len(orders))
+	for _, order := range orders {
+		_, err := rps.archive().ReplaceOne(ctx, bson.D{{Key: "_id", Value: order.OrderID}}, order,
+			options.Replace().SetUpsert(true))
+		if err != nil {
+			return nil, mongoError("can't archive orders", err)
+		}
+		// order is removed only if it wasn't changed since it was copied
+		copied := bson.D{{Key: "_id", Value: order.OrderID}, {Key: "updatedAt", Value: order.UpdatedAt}}
+		result, err := rps.orders().DeleteOne(ctx, scoped(scope, append(copied,
+			bson.E{Key: "isDelivered", Value: true},
+			bson.E{Key: "deliveredAt", Value: order.DeliveredAt},
+		)))
+		if err != nil {
+			return nil, mongoError("can't archive orders", err)
+		}
+		if result.DeletedCount == 0 {
+			// order changed meanwhile and stays live, its stale copy is dropped
+			if _, err := rps.archive().DeleteOne(ctx, copied); err != nil {
+				return nil, mongoError("can't archive orders", err)
+			}
+			continue
+		}
+		moved = append(moved, order)
+	}
+	return moved, nil
+}
+
+// GetArchivedOrder method returns Order object from archive collection
+// with selection by OrderID
+func (rps MongoRepository) GetArchivedOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var order model.Order
+	err = rps.archive().FindOne(ctx, scoped(scope, bson.D{{Key: "_id", Value: orderID}})).Decode(&order)
+	if err != nil {
+		return nil, mongoError("can't get archived order", err)
+	}
+	return &order, nil
+}
+
+// GetArchivedOrders method returns up to limit archived orders with OrderID
+// greater than afterID ordered by OrderID
+func (rps MongoRepository) GetArchivedOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	var orders []*model.Order
+	if err := findPage(ctx, rps.archive(), afterID, limit, &orders); err != nil {
+		return nil, mongoError("can't get archived orders", err)
+	}
+	return orders, nil
+}
+
+// SaveArchivedOrder method saves order into archive collection, archived
+// order with the same OrderID is replaced
+func (rps MongoRepository) SaveArchivedOrder(ctx context.Context, order *model.Order) error {
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	_, err = rps.archive().ReplaceOne(ctx, bson.D{{Key: "_id", Value: order.OrderID}}, order,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		return mongoError("can't save archived order", err)
+	}
 	return nil
 }
 
+// GetTenants method returns up to limit tenants with TenantID greater than
+// afterID ordered by TenantID
+func (rps MongoRepository) GetTenants(ctx context.Context, afterID string, limit int) ([]*model.Tenant, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+	defer cancel()
+	cursor, err := rps.tenants().Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$gt", Value: afterID}}}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, mongoError("can't get tenants", err)
+	}
+	var tenants []*model.Tenant
+	if err := cursor.All(ctx, &tenants); err != nil {
+		return nil, mongoError("can't get tenants", err)
+	}
+	return tenants, nil
+}
+
+// CheckTransactions method returns error if mongo deployment can't run
+// transactions. Only replica set members and mongos support them
+func (rps MongoRepository) CheckTransactions(ctx context.Context) error {
+	var status struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := rps.DBconn.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&status)
+	if err != nil {
+		return mongoError("can't get deployment status", err)
+	}
+	if status.SetName == "" && status.Msg != "isdbgrid" {
+		return fmt.Errorf("mongo repository: transactions require replica set or sharded cluster, standalone server is used")
+	}
+	return nil
+}
+
+// WithinTransaction method runs fn inside mongo session transaction. Calls
+// made with ctx passed to fn are bound to the session. If ctx already
+// carries session, fn joins its transaction. With WithoutTransactions fn
+// runs without transaction, every call is atomic on its own, which is
+// enough for callers that change single document
+func (rps MongoRepository) WithinTransaction(ctx context.Context, fn TxFunc) error {
+	if mongo.SessionFromContext(ctx) != nil || rps.WithoutTransactions {
+		return fn(ctx, rps)
+	}
+	session, err := rps.DBconn.StartSession()
+	if err != nil {
+		return mongoError("can't start session", err)
+	}
+	// EndSession aborts transaction which is still in progress, so
+	// panic in fn doesn't leave it open
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx, rps)
+	})
+	return err
+}
+
 // CloseDBConnection is using for closing current mongo database connection
 func (rps MongoRepository) CloseDBConnection() error {
 	if err := rps.DBconn.Disconnect(context.Background()); err != nil {
-		return fmt.Errorf("mongo repository: database connection closed")
+		return fmt.Errorf("mongo repository: can't close database connection - %w", err)
 	}
 	return nil
 }
+
+// mongoError wraps mongo error into repository Error of matching kind
+func mongoError(message string, err error) error {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NewError(ErrNotFound, "mongo repository: %s - %w", message, err)
+	case mongo.IsDuplicateKeyError(err):
+		return NewError(ErrConflict, "mongo repository: %s - %w", message, err)
+	case mongo.IsTimeout(err), mongo.IsNetworkError(err), errors.Is(err, mongo.ErrClientDisconnected):
+		return NewError(ErrUnavailable, "mongo repository: %s - %w", message, err)
+	}
+	return fmt.Errorf("mongo repository: %s - %w", message, err)
+}
@@ -0,0 +1,41 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/repository/repotest"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestMongoRepository runs against replica set of MONGO_URL, it is skipped
+// if the variable isn't set
+func TestMongoRepository(t *testing.T) {
+	url := os.Getenv("MONGO_URL")
+	if url == "" {
+		t.Skip("MONGO_URL isn't set")
+	}
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		ctx := context.Background()
+		client, err := mongo.Connect(ctx, options.Client().ApplyURI(url))
+		if err != nil {
+			t.Fatalf("can't connect to mongo database - %v", err)
+		}
+		rps := repository.MongoRepository{DBconn: client}
+		t.Cleanup(func() {
+			if err := rps.CloseDBConnection(); err != nil {
+				t.Errorf("can't close mongo database - %v", err)
+			}
+		})
+		if err := rps.CheckTransactions(ctx); err != nil {
+			t.Fatalf("mongo database can't run transactions - %v", err)
+		}
+		if err := rps.Migrate(ctx); err != nil {
+			t.Fatalf("mongo migrations failed - %v", err)
+		}
+		return rps
+	})
+}
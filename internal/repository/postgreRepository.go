@@ -2,16 +2,68 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"net"
+	"strings"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	log "github.com/sirupsen/logrus"
 )
 
+// postgres error codes and classes, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgUniqueViolation       = "23505"
+	pgIntegrityViolation    = "23"
+	pgDataException         = "22"
+	pgConnectionException   = "08"
+	pgInsufficientResources = "53"
+)
+
 // PostgresRepository type replies for accessing to postgres database
 type PostgresRepository struct {
-	DBconn *pgxpool.Pool
+	DBconn   *pgxpool.Pool
+	Replicas *ReplicaSet
+	tx       pgx.Tx
+}
+
+// pgxQuerier is implemented by both pgxpool.Pool and pgx.Tx
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// db returns current transaction if repository is bound to it, else pool
+func (rps PostgresRepository) db() pgxQuerier {
+	if rps.tx != nil {
+		return rps.tx
+	}
+	return rps.DBconn
+}
+
+// read runs fn on healthy replica unless repository is bound to transaction
+// or ctx is pinned to primary. If replica turns out to be unavailable, fn is
+// retried on primary
+func (rps PostgresRepository) read(ctx context.Context, fn func(pgxQuerier) error) error {
+	if rps.tx != nil || isPinnedToPrimary(ctx) {
+		return fn(rps.db())
+	}
+	replica, idx := rps.Replicas.pick()
+	if replica == nil {
+		return fn(rps.DBconn)
+	}
+	err := fn(replica)
+	if err == nil || !errors.Is(pgError("replica read failed", err), ErrUnavailable) {
+		return err
+	}
+	rps.Replicas.markUnhealthy(idx)
+	return fn(rps.DBconn)
 }
 
 // Save save Order object into postgresql database
@@ -20,10 +72,16 @@ func (rps PostgresRepository) Save(ctx context.Context, order *model.Order) erro
 		"orderID":   order.OrderID,
 		"orderName": order.OrderName,
 	}).Debugf("repository: create order")
-	_, err := rps.DBconn.Exec(ctx, `insert into orders (orderID, orderName, orderCost, isDelivered) 
-		values ($1, $2, $3, $4)`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered)
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	pinPrimary(ctx)
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	_, err = rps.db().Exec(ctx, `insert into orders (orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat) 
+		values ($1, $2, $3, $4, $5, $6, $7)`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, order.TenantID, order.DeliveredAt, order.UpdatedAt)
 	if err != nil {
-		return fmt.Errorf("postgres repository: can't save order", err)
+		return pgError("can't save order", err)
 	}
 	return nil
 }
@@ -34,11 +92,18 @@ func (rps PostgresRepository) Get(ctx context.Context, orderID string) (*model.O
 	log.WithFields(log.Fields{
 		"orderID": orderID,
 	}).Debugf("repository: get order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var order model.Order
-	err := rps.DBconn.QueryRow(ctx, `select orderID, orderName, orderCost, isDelivered from orders 
-		where orderID=$1`, orderID).Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered)
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		return db.QueryRow(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders 
+			where orderID=$1 and ($2 = '' or tenantid = $2)`, orderID, scope).Scan(
+			&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("postgres repository: can't get order - %w", err)
+		return nil, pgError("can't get order", err)
 	}
 	return &order, nil
 }
@@ -50,11 +115,20 @@ func (rps PostgresRepository) Update(ctx context.Context, order *model.Order) er
 		"orderID":   order.OrderID,
 		"orderName": order.OrderName,
 	}).Debugf("postgres repository: update order")
-	_, err := rps.DBconn.Exec(ctx, `update orders
-		set orderName=$2, orderCost=$3, isDelivered=$4
-		where orderID=$1`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered)
+	scope, err := tenantScope(ctx)
 	if err != nil {
-		return fmt.Errorf("postgres repository: can't update order - %w", err)
+		return err
+	}
+	pinPrimary(ctx)
+	tag, err := rps.db().Exec(ctx, `update orders
+		set orderName=$2, orderCost=$3, isDelivered=$4, deliveredat=$6, updatedat=$7
+		where orderID=$1 and ($5 = '' or tenantid = $5)`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, scope,
+		order.DeliveredAt, order.UpdatedAt)
+	if err != nil {
+		return pgError("can't update order", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NewError(ErrNotFound, "postgres repository: can't update order - order %s not found", order.OrderID)
 	}
 	return nil
 }
@@ -65,9 +139,17 @@ func (rps PostgresRepository) Delete(ctx context.Context, orderID string) error
 	log.WithFields(log.Fields{
 		"orderID": orderID,
 	}).Debugf("postgres repository: delete order")
-	_, err := rps.DBconn.Exec(ctx, "delete from orders where orderID=$1", orderID)
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	pinPrimary(ctx)
+	tag, err := rps.db().Exec(ctx, "delete from orders where orderID=$1 and ($2 = '' or tenantid = $2)", orderID, scope)
 	if err != nil {
-		return fmt.Errorf("repository: can't delete order - %w", err)
+		return pgError("can't delete order", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NewError(ErrNotFound, "postgres repository: can't delete order - order %s not found", orderID)
 	}
 	return nil
 }
@@ -79,10 +161,19 @@ func (rps PostgresRepository) SaveAuthUser(ctx context.Context, authUser *model.
 		"userID":   authUser.UserUUID,
 		"userName": authUser.UserName,
 	}).Debugf("postgres repository: save authUser")
-	_, err := rps.DBconn.Exec(ctx, `insert into authusers (username, email, password) 
-		values($1, $2, $3)`, authUser.UserName, authUser.Email, authUser.Password)
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	pinPrimary(ctx)
+	if authUser.UserUUID == "" {
+		authUser.UserUUID = uuid.New().String()
+	}
+	authUser.TenantID = ownerTenant(scope, authUser.TenantID)
+	_, err = rps.db().Exec(ctx, `insert into authusers (useruuid, username, email, password, tenantid) 
+		values($1, $2, $3, $4, $5)`, authUser.UserUUID, authUser.UserName, authUser.Email, authUser.Password, authUser.TenantID)
 	if err != nil {
-		return fmt.Errorf("postgres repository: can't save authUser - %w", err)
+		return pgError("can't save authUser", err)
 	}
 	return nil
 }
@@ -93,11 +184,18 @@ func (rps PostgresRepository) GetAuthUser(ctx context.Context, email string) (*m
 	log.WithFields(log.Fields{
 		"email": email,
 	}).Debugf("postgres repository: get authUser by email")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var authUser model.AuthUser
-	err := rps.DBconn.QueryRow(ctx, `select useruuid, username, email, password from authusers
-		where email=$1`, email).Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password)
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		return db.QueryRow(ctx, `select useruuid, username, email, password, tenantid from authusers
+			where email=$1 and ($2 = '' or tenantid = $2)`, email, scope).Scan(
+			&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.TenantID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("repository: can't get authUser - %w", err)
+		return nil, pgError("can't get authUser", err)
 	}
 	return &authUser, nil
 }
@@ -108,11 +206,18 @@ func (rps PostgresRepository) GetAuthUserByID(ctx context.Context, userUUID stri
 	log.WithFields(log.Fields{
 		"userID": userUUID,
 	}).Debugf("postgres repository: get authUser by id")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
 	var authUser model.AuthUser
-	err := rps.DBconn.QueryRow(ctx, `select useruuid, username, email, password, refreshtoken from authusers
-		where useruuid=$1`, userUUID).Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.RefreshToken)
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		return db.QueryRow(ctx, `select useruuid, username, email, password, refreshtoken, tenantid from authusers
+			where useruuid=$1 and ($2 = '' or tenantid = $2)`, userUUID, scope).Scan(
+			&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.RefreshToken, &authUser.TenantID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("repository: can't get authUser by ID - %w", err)
+		return nil, pgError("can't get authUser by ID", err)
 	}
 	return &authUser, nil
 }
@@ -123,17 +228,425 @@ func (rps PostgresRepository) UpdateAuthUser(ctx context.Context, email, refresh
 		"email":        email,
 		"refreshToken": refreshToken,
 	}).Debugf("postgres repository: update authUser")
-	_, err := rps.DBconn.Exec(ctx, `update authusers
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	pinPrimary(ctx)
+	tag, err := rps.db().Exec(ctx, `update authusers
 		set refreshtoken=$2
-		where email=$1`, email, refreshToken)
+		where email=$1 and ($3 = '' or tenantid = $3)`, email, refreshToken, scope)
+	if err != nil {
+		return pgError("can't update authUser", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NewError(ErrNotFound, "postgres repository: can't update authUser - email %s not found", email)
+	}
+	return nil
+}
+
+// GetOrders method returns up to limit orders with OrderID greater than
+// afterID ordered by OrderID, so orders can be read page by page
+func (rps PostgresRepository) GetOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("postgres repository: get orders")
+	scope, err := tenantScope(ctx)
 	if err != nil {
-		return fmt.Errorf("repository: can't update authUser - %w", err)
+		return nil, err
+	}
+	var orders []*model.Order
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		orders = nil
+		rows, err := db.Query(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders
+			where orderID > $1 and ($3 = '' or tenantid = $3)
+			order by orderID collate "C" limit $2`, afterID, limit, scope)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var order model.Order
+			if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+				return err
+			}
+			orders = append(orders, &order)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, pgError("can't get orders", err)
+	}
+	return orders, nil
+}
+
+// GetRecentOrders method returns up to limit orders updated before order
+// identified by beforeUpdatedAt and beforeID, most recently updated first.
+// Empty beforeID starts from the most recently updated order
+func (rps PostgresRepository) GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"beforeUpdatedAt": beforeUpdatedAt,
+		"beforeID":        beforeID,
+		"limit":           limit,
+	}).Debugf("postgres repository: get recent orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var orders []*model.Order
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		orders = nil
+		rows, err := db.Query(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders
+			where ($2 = '' or updatedat < $1 or (updatedat = $1 and orderID collate "C" < $2)) and ($4 = '' or tenantid = $4)
+			order by updatedat desc, orderID collate "C" desc limit $3`, beforeUpdatedAt, beforeID, limit, scope)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var order model.Order
+			if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+				return err
+			}
+			orders = append(orders, &order)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, pgError("can't get recent orders", err)
+	}
+	return orders, nil
+}
+
+// GetAuthUsers method returns up to limit users with UserUUID greater than
+// afterID ordered by UserUUID
+func (rps PostgresRepository) GetAuthUsers(ctx context.Context, afterID string, limit int) ([]*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("postgres repository: get authUsers")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var authUsers []*model.AuthUser
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		authUsers = nil
+		rows, err := db.Query(ctx, `select useruuid, username, email, password, refreshtoken, tenantid from authusers
+			where useruuid > $1 and ($3 = '' or tenantid = $3)
+			order by useruuid collate "C" limit $2`, afterID, limit, scope)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var authUser model.AuthUser
+			if err := rows.Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password,
+				&authUser.RefreshToken, &authUser.TenantID); err != nil {
+				return err
+			}
+			authUsers = append(authUsers, &authUser)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, pgError("can't get authUsers", err)
+	}
+	return authUsers, nil
+}
+
+// SaveTenant method saves tenant into postgres database
+func (rps PostgresRepository) SaveTenant(ctx context.Context, t *model.Tenant) error {
+	log.WithFields(log.Fields{
+		"tenantID": t.TenantID,
+	}).Debugf("postgres repository: save tenant")
+	pinPrimary(ctx)
+	_, err := rps.db().Exec(ctx, `insert into tenants (tenantid, name, disabled) values ($1, $2, $3)`,
+		t.TenantID, t.Name, t.Disabled)
+	if err != nil {
+		return pgError("can't save tenant", err)
+	}
+	return nil
+}
+
+// GetTenant method returns tenant from postgres database with selection by id
+func (rps PostgresRepository) GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	log.WithFields(log.Fields{
+		"tenantID": tenantID,
+	}).Debugf("postgres repository: get tenant")
+	var t model.Tenant
+	err := rps.read(ctx, func(db pgxQuerier) error {
+		return db.QueryRow(ctx, `select tenantid, name, disabled from tenants where tenantid=$1`, tenantID).Scan(
+			&t.TenantID, &t.Name, &t.Disabled)
+	})
+	if err != nil {
+		return nil, pgError("can't get tenant", err)
+	}
+	return &t, nil
+}
+
+// UpdateTenant method updates tenant name and state in postgres database
+func (rps PostgresRepository) UpdateTenant(ctx context.Context, t *model.Tenant) error {
+	log.WithFields(log.Fields{
+		"tenantID": t.TenantID,
+		"disabled": t.Disabled,
+	}).Debugf("postgres repository: update tenant")
+	pinPrimary(ctx)
+	tag, err := rps.db().Exec(ctx, `update tenants set name=$2, disabled=$3 where tenantid=$1`,
+		t.TenantID, t.Name, t.Disabled)
+	if err != nil {
+		return pgError("can't update tenant", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return NewError(ErrNotFound, "postgres repository: can't update tenant - tenant %s not found", t.TenantID)
+	}
+	return nil
+}
+
+// ArchiveOrders method moves up to limit orders delivered before
+// deliveredBefore unix time from orders to archived_orders table and
+// returns moved orders
+func (rps PostgresRepository) ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"deliveredBefore": deliveredBefore,
+		"limit":           limit,
+	}).Debugf("postgres repository: archive orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pinPrimary(ctx)
+	rows, err := rps.db().Query(ctx, `with moved as (
+			delete from orders where orderID in (
+				select orderID from orders
+				where isDelivered and deliveredat > 0 and deliveredat < $1 and ($3 = '' or tenantid = $3)
+				order by orderID limit $2
+				for update skip locked)
+			returning orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat)
+		insert into archived_orders (orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat)
+		select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from moved
+		on conflict (orderID) do update set orderName = excluded.orderName, orderCost = excluded.orderCost,
+			isDelivered = excluded.isDelivered, tenantid = excluded.tenantid, deliveredat = excluded.deliveredat, updatedat = excluded.updatedat
+		returning orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat`, deliveredBefore, limit, scope)
+	if err != nil {
+		return nil, pgError("can't archive orders", err)
+	}
+	defer rows.Close()
+	var orders []*model.Order
+	for rows.Next() {
+		var order model.Order
+		if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+			return nil, pgError("can't archive orders", err)
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, pgError("can't archive orders", err)
+	}
+	return orders, nil
+}
+
+// GetArchivedOrder method returns Order object from archived_orders table
+// with selection by OrderID
+func (rps PostgresRepository) GetArchivedOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("postgres repository: get archived order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var order model.Order
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		return db.QueryRow(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from archived_orders
+			where orderID=$1 and ($2 = '' or tenantid = $2)`, orderID, scope).Scan(
+			&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt)
+	})
+	if err != nil {
+		return nil, pgError("can't get archived order", err)
+	}
+	return &order, nil
+}
+
+// GetArchivedOrders method returns up to limit archived orders with OrderID
+// greater than afterID ordered by OrderID
+func (rps PostgresRepository) GetArchivedOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("postgres repository: get archived orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var orders []*model.Order
+	err = rps.read(ctx, func(db pgxQuerier) error {
+		orders = nil
+		rows, err := db.Query(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from archived_orders
+			where orderID > $1 and ($3 = '' or tenantid = $3)
+			order by orderID collate "C" limit $2`, afterID, limit, scope)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var order model.Order
+			if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+				return err
+			}
+			orders = append(orders, &order)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, pgError("can't get archived orders", err)
+	}
+	return orders, nil
+}
+
+// SaveArchivedOrder method saves order into archived_orders table, archived
+// order with the same OrderID is replaced
+func (rps PostgresRepository) SaveArchivedOrder(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID": order.OrderID,
+	}).Debugf("postgres repository: save archived order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	pinPrimary(ctx)
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	_, err = rps.db().Exec(ctx, `insert into archived_orders (orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat)
+		values ($1, $2, $3, $4, $5, $6, $7)
+		on conflict (orderID) do update set orderName = excluded.orderName, orderCost = excluded.orderCost,
+			isDelivered = excluded.isDelivered, tenantid = excluded.tenantid, deliveredat = excluded.deliveredat, updatedat = excluded.updatedat`,
+		order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, order.TenantID, order.DeliveredAt, order.UpdatedAt)
+	if err != nil {
+		return pgError("can't save archived order", err)
+	}
+	return nil
+}
+
+// GetTenants method returns up to limit tenants with TenantID greater than
+// afterID ordered by TenantID
+func (rps PostgresRepository) GetTenants(ctx context.Context, afterID string, limit int) ([]*model.Tenant, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("postgres repository: get tenants")
+	var tenants []*model.Tenant
+	err := rps.read(ctx, func(db pgxQuerier) error {
+		tenants = nil
+		rows, err := db.Query(ctx, `select tenantid, name, disabled from tenants
+			where tenantid > $1 order by tenantid collate "C" limit $2`, afterID, limit)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var t model.Tenant
+			if err := rows.Scan(&t.TenantID, &t.Name, &t.Disabled); err != nil {
+				return err
+			}
+			tenants = append(tenants, &t)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, pgError("can't get tenants", err)
+	}
+	return tenants, nil
+}
+
+// WithinTransaction method runs fn inside postgres transaction. If repository
+// is already bound to transaction, fn joins it
+func (rps PostgresRepository) WithinTransaction(ctx context.Context, fn TxFunc) (err error) {
+	if rps.tx != nil {
+		return fn(ctx, rps)
+	}
+	pinPrimary(ctx)
+	tx, err := rps.DBconn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return pgError("can't begin transaction", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback(ctx)
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(ctx); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+				log.Errorf("postgres repository: can't rollback transaction - %e", rbErr)
+			}
+		}
+	}()
+	if err = fn(ctx, PostgresRepository{DBconn: rps.DBconn, Replicas: rps.Replicas, tx: tx}); err != nil {
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return pgError("can't commit transaction", err)
+	}
+	return nil
+}
+
+// Migrate method applies shared sql migrations which weren't applied yet
+func (rps PostgresRepository) Migrate(ctx context.Context) error {
+	migrations, err := loadMigrations("postgres")
+	if err != nil {
+		return err
+	}
+	if _, err := rps.DBconn.Exec(ctx, migrationsTable); err != nil {
+		return fmt.Errorf("postgres repository: can't create migrations table - %w", err)
+	}
+	for _, m := range migrations {
+		err := rps.DBconn.BeginFunc(ctx, func(tx pgx.Tx) error {
+			tag, err := tx.Exec(ctx, `insert into schema_migrations (version) values ($1)
+				on conflict do nothing`, m.version)
+			if err != nil || tag.RowsAffected() == 0 {
+				return err
+			}
+			log.WithFields(log.Fields{
+				"version": m.version,
+			}).Info("postgres repository: apply migration")
+			_, err = tx.Exec(ctx, m.query)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("postgres repository: can't apply migration %s - %w", m.version, err)
+		}
 	}
 	return nil
 }
 
 // CloseDBConnection is using to close current postgres database connection
 func (rps PostgresRepository) CloseDBConnection() error {
+	if rps.tx != nil {
+		return fmt.Errorf("postgres repository: can't close database connection inside transaction")
+	}
+	rps.Replicas.Close()
 	rps.DBconn.Close()
-	return fmt.Errorf("repository: database connection closed")
+	return nil
+}
+
+// pgError wraps postgres error into repository Error of matching kind
+func pgError(message string, err error) error {
+	var pgErr *pgconn.PgError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return NewError(ErrNotFound, "postgres repository: %s - %w", message, err)
+	case errors.As(err, &pgErr):
+		switch {
+		case pgErr.Code == pgUniqueViolation:
+			return NewError(ErrConflict, "postgres repository: %s - %w", message, err)
+		case strings.HasPrefix(pgErr.Code, pgDataException), strings.HasPrefix(pgErr.Code, pgIntegrityViolation):
+			return NewError(ErrValidation, "postgres repository: %s - %w", message, err)
+		case strings.HasPrefix(pgErr.Code, pgConnectionException), strings.HasPrefix(pgErr.Code, pgInsufficientResources):
+			return NewError(ErrUnavailable, "postgres repository: %s - %w", message, err)
+		}
+	case pgconn.Timeout(err), errors.As(err, &netErr):
+		return NewError(ErrUnavailable, "postgres repository: %s - %w", message, err)
+	}
+	return fmt.Errorf("postgres repository: %s - %w", message, err)
 }
@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	log "github.com/sirupsen/logrus"
+)
+
+// defaultReplicaCheckInterval is how often replicas are health-checked when
+// interval isn't positive
+const defaultReplicaCheckInterval = 5 * time.Second
+
+// ReplicaSet type routes postgres reads to read replicas in round-robin
+// order. Replicas are health-checked in background and skipped while
+// they are unhealthy
+type ReplicaSet struct {
+	pools   []*pgxpool.Pool
+	healthy []int32
+	next    uint32
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewReplicaSet returns replica set over pools and starts health checks
+// with checkInterval period, or defaultReplicaCheckInterval if it isn't
+// positive
+func NewReplicaSet(pools []*pgxpool.Pool, checkInterval time.Duration) *ReplicaSet {
+	if checkInterval <= 0 {
+		checkInterval = defaultReplicaCheckInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rs := &ReplicaSet{
+		pools:   pools,
+		healthy: make([]int32, len(pools)),
+		cancel:  cancel,
+	}
+	rs.check(ctx)
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		ticker := time.NewTicker(checkInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				rs.check(ctx)
+			}
+		}
+	}()
+	return rs
+}
+
+// pick returns next healthy replica and its index, or nil if there is none
+func (rs *ReplicaSet) pick() (*pgxpool.Pool, int) {
+	if rs == nil || len(rs.pools) == 0 {
+		return nil, -1
+	}
+	start := atomic.AddUint32(&rs.next, 1)
+	for i := 0; i < len(rs.pools); i++ {
+		idx := int((start + uint32(i)) % uint32(len(rs.pools)))
+		if atomic.LoadInt32(&rs.healthy[idx]) == 1 {
+			return rs.pools[idx], idx
+		}
+	}
+	return nil, -1
+}
+
+// markUnhealthy excludes replica from routing until next successful check
+func (rs *ReplicaSet) markUnhealthy(idx int) {
+	if atomic.CompareAndSwapInt32(&rs.healthy[idx], 1, 0) {
+		log.WithFields(log.Fields{
+			"replica": idx,
+		}).Warn("postgres repository: replica marked unhealthy")
+	}
+}
+
+func (rs *ReplicaSet) check(ctx context.Context) {
+	for idx, pool := range rs.pools {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout*time.Second)
+		err := pool.Ping(pingCtx)
+		cancel()
+		var state int32
+		if err == nil {
+			state = 1
+		}
+		if atomic.SwapInt32(&rs.healthy[idx], state) != state {
+			log.WithFields(log.Fields{
+				"replica": idx,
+				"healthy": err == nil,
+				"err":     err,
+			}).Info("postgres repository: replica health changed")
+		}
+	}
+}
+
+// Pools returns replica pools in the order they were passed to NewReplicaSet
+func (rs *ReplicaSet) Pools() []*pgxpool.Pool {
+	if rs == nil {
+		return nil
+	}
+	return rs.pools
+}
+
+// Close stops health checks and closes replica pools
+func (rs *ReplicaSet) Close() {
+	if rs == nil {
+		return
+	}
+	rs.cancel()
+	rs.wg.Wait()
+	for _, pool := range rs.pools {
+		pool.Close()
+	}
+}
+
+type primaryPinKey struct{}
+
+type primaryPin struct {
+	pinned int32
+}
+
+// WithReadAfterWrite returns context in which reads go to replicas only
+// until first write is made with it. After that every read made with the
+// context is served by primary, so request sees its own writes
+func WithReadAfterWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryPinKey{}, &primaryPin{})
+}
+
+// WithPrimary returns context in which all reads are served by primary
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryPinKey{}, &primaryPin{pinned: 1})
+}
+
+func pinPrimary(ctx context.Context) {
+	if pin, ok := ctx.Value(primaryPinKey{}).(*primaryPin); ok {
+		atomic.StoreInt32(&pin.pinned, 1)
+	}
+}
+
+// PinnedToPrimary function reports whether reads made with ctx are served
+// by primary
+func PinnedToPrimary(ctx context.Context) bool {
+	return isPinnedToPrimary(ctx)
+}
+
+func isPinnedToPrimary(ctx context.Context) bool {
+	pin, ok := ctx.Value(primaryPinKey{}).(*primaryPin)
+	return ok && atomic.LoadInt32(&pin.pinned) == 1
+}
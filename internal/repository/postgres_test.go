@@ -0,0 +1,37 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/repository/repotest"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TestPostgresRepository runs against database of POSTGRES_URL, it is
+// skipped if the variable isn't set
+func TestPostgresRepository(t *testing.T) {
+	url := os.Getenv("POSTGRES_URL")
+	if url == "" {
+		t.Skip("POSTGRES_URL isn't set")
+	}
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		ctx := context.Background()
+		conn, err := pgxpool.Connect(ctx, url)
+		if err != nil {
+			t.Fatalf("can't connect to postgres database - %v", err)
+		}
+		rps := repository.PostgresRepository{DBconn: conn}
+		t.Cleanup(func() {
+			if err := rps.CloseDBConnection(); err != nil {
+				t.Errorf("can't close postgres database - %v", err)
+			}
+		})
+		if err := rps.Migrate(ctx); err != nil {
+			t.Fatalf("postgres migrations failed - %v", err)
+		}
+		return rps
+	})
+}
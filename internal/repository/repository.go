@@ -6,7 +6,8 @@ import (
 	"github.com/EgorBessonov/CRUDServer/internal/model"
 )
 
-// Repository interface represent repository behavior
+// Repository interface represent repository behavior. Orders and auth
+// users are scoped by tenant stored in context, see package tenant
 type Repository interface {
 	Save(context.Context, *model.Order) error
 	Get(context.Context, string) (*model.Order, error)
@@ -16,5 +17,22 @@ type Repository interface {
 	GetAuthUser(context.Context, string) (*model.AuthUser, error)
 	GetAuthUserByID(context.Context, string) (*model.AuthUser, error)
 	UpdateAuthUser(ctx context.Context, email, refreshToken string) error
+	GetOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error)
+	GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) ([]*model.Order, error)
+	GetAuthUsers(ctx context.Context, afterID string, limit int) ([]*model.AuthUser, error)
+	SaveTenant(context.Context, *model.Tenant) error
+	GetTenant(context.Context, string) (*model.Tenant, error)
+	UpdateTenant(context.Context, *model.Tenant) error
+	ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) ([]*model.Order, error)
+	GetArchivedOrder(context.Context, string) (*model.Order, error)
+	GetArchivedOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error)
+	SaveArchivedOrder(context.Context, *model.Order) error
+	GetTenants(ctx context.Context, afterID string, limit int) ([]*model.Tenant, error)
+	WithinTransaction(context.Context, TxFunc) error
 	CloseDBConnection() error
 }
+
+// TxFunc type represents unit of work. All calls made through rps with ctx
+// share one transaction, which is committed when function returns nil and
+// rolled back when it returns error or panics
+type TxFunc func(ctx context.Context, rps Repository) error
@@ -0,0 +1,710 @@
+// Package repotest replies conformance suite for repository.Repository implementations
+package repotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const (
+	concurrentWorkers = 16
+	pageSize          = 2
+)
+
+// Factory type returns ready to use repository instance for one test case.
+// Implementations can register cleanup with t.Cleanup
+type Factory func(t *testing.T) repository.Repository
+
+// Run function exercises every method of repository.Repository against
+// repository instances returned by newRepository
+func Run(t *testing.T, newRepository Factory) {
+	t.Helper()
+	tests := []struct {
+		name string
+		run  func(*testing.T, repository.Repository)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"GetNotFound", testGetNotFound},
+		{"SaveDuplicate", testSaveDuplicate},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"SaveAndGetAuthUser", testSaveAndGetAuthUser},
+		{"GetAuthUserNotFound", testGetAuthUserNotFound},
+		{"SaveAuthUserDuplicate", testSaveAuthUserDuplicate},
+		{"UpdateAuthUser", testUpdateAuthUser},
+		{"GetOrdersPages", testGetOrdersPages},
+		{"GetRecentOrdersPages", testGetRecentOrdersPages},
+		{"GetAuthUsersPages", testGetAuthUsersPages},
+		{"ConcurrentSaveAndGet", testConcurrentSaveAndGet},
+		{"ConcurrentUpdate", testConcurrentUpdate},
+		{"TransactionCommit", testTransactionCommit},
+		{"TransactionRollbackOnError", testTransactionRollbackOnError},
+		{"TransactionRollbackOnPanic", testTransactionRollbackOnPanic},
+		{"TenantIsolation", testTenantIsolation},
+		{"TenantAuthUserIsolation", testTenantAuthUserIsolation},
+		{"UnscopedContextRefused", testUnscopedContextRefused},
+		{"SaveAndUpdateTenant", testSaveAndUpdateTenant},
+		{"ArchiveOrders", testArchiveOrders},
+		{"SaveArchivedOrderAndPages", testSaveArchivedOrderAndPages},
+		{"GetTenantsPages", testGetTenantsPages},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newRepository(t))
+		})
+	}
+}
+
+// allTenants returns context of system jobs which sees data of all tenants
+func allTenants() context.Context {
+	return tenant.AllTenants(context.Background())
+}
+
+func newOrder() *model.Order {
+	return &model.Order{
+		OrderID:     uuid.New().String(),
+		OrderName:   "order-" + uuid.New().String()[:8],
+		OrderCost:   100,
+		IsDelivered: false,
+	}
+}
+
+func newAuthUser() *model.AuthUser {
+	id := uuid.New().String()
+	return &model.AuthUser{
+		UserName: "user-" + id[:8],
+		Email:    id + "@example.com",
+		Password: "password-" + id[:8],
+	}
+}
+
+func mustSave(t *testing.T, rps repository.Repository, order *model.Order) {
+	t.Helper()
+	if err := rps.Save(allTenants(), order); err != nil {
+		t.Fatalf("Save(%q) failed - %v", order.OrderID, err)
+	}
+}
+
+func mustGet(t *testing.T, rps repository.Repository, orderID string) *model.Order {
+	t.Helper()
+	order, err := rps.Get(allTenants(), orderID)
+	if err != nil {
+		t.Fatalf("Get(%q) failed - %v", orderID, err)
+	}
+	if order == nil {
+		t.Fatalf("Get(%q) returned nil order without error", orderID)
+	}
+	return order
+}
+
+func assertOrder(t *testing.T, got, want *model.Order) {
+	t.Helper()
+	if *got != *want {
+		t.Errorf("order mismatch: got %+v, want %+v", *got, *want)
+	}
+}
+
+func testSaveAndGet(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	mustSave(t, rps, order)
+	assertOrder(t, mustGet(t, rps, order.OrderID), order)
+}
+
+func testGetNotFound(t *testing.T, rps repository.Repository) {
+	order, err := rps.Get(allTenants(), uuid.New().String())
+	if !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Get of missing order returned %+v, %v, want %v", order, err, repository.ErrNotFound)
+	}
+}
+
+func testSaveDuplicate(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	mustSave(t, rps, order)
+	duplicate := *order
+	duplicate.OrderName = "duplicate"
+	if err := rps.Save(allTenants(), &duplicate); !errors.Is(err, repository.ErrConflict) {
+		t.Fatalf("Save of duplicate orderID returned %v, want %v", err, repository.ErrConflict)
+	}
+	assertOrder(t, mustGet(t, rps, order.OrderID), order)
+}
+
+func testUpdate(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	mustSave(t, rps, order)
+	updated := &model.Order{
+		OrderID:     order.OrderID,
+		OrderName:   "updated",
+		OrderCost:   order.OrderCost + 1,
+		IsDelivered: true,
+		TenantID:    order.TenantID,
+	}
+	if err := rps.Update(allTenants(), updated); err != nil {
+		t.Fatalf("Update failed - %v", err)
+	}
+	assertOrder(t, mustGet(t, rps, order.OrderID), updated)
+	if err := rps.Update(allTenants(), newOrder()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update of missing order returned %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func testDelete(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	mustSave(t, rps, order)
+	if err := rps.Delete(allTenants(), order.OrderID); err != nil {
+		t.Fatalf("Delete failed - %v", err)
+	}
+	if got, err := rps.Get(allTenants(), order.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Fatalf("Get after Delete returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	if err := rps.Delete(allTenants(), order.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Delete of missing order returned %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func mustSaveAuthUser(t *testing.T, rps repository.Repository, authUser *model.AuthUser) *model.AuthUser {
+	t.Helper()
+	if err := rps.SaveAuthUser(allTenants(), authUser); err != nil {
+		t.Fatalf("SaveAuthUser(%q) failed - %v", authUser.Email, err)
+	}
+	saved, err := rps.GetAuthUser(allTenants(), authUser.Email)
+	if err != nil {
+		t.Fatalf("GetAuthUser(%q) failed - %v", authUser.Email, err)
+	}
+	if saved == nil {
+		t.Fatalf("GetAuthUser(%q) returned nil user without error", authUser.Email)
+	}
+	return saved
+}
+
+func testSaveAndGetAuthUser(t *testing.T, rps repository.Repository) {
+	authUser := newAuthUser()
+	saved := mustSaveAuthUser(t, rps, authUser)
+	if saved.UserUUID == "" {
+		t.Error("saved authUser has empty userID")
+	}
+	if saved.UserName != authUser.UserName || saved.Email != authUser.Email || saved.Password != authUser.Password {
+		t.Errorf("authUser mismatch: got %+v, want %+v", *saved, *authUser)
+	}
+	byID, err := rps.GetAuthUserByID(allTenants(), saved.UserUUID)
+	if err != nil {
+		t.Fatalf("GetAuthUserByID failed - %v", err)
+	}
+	if byID == nil || byID.Email != authUser.Email {
+		t.Errorf("GetAuthUserByID returned %+v, want email %q", byID, authUser.Email)
+	}
+}
+
+func testGetAuthUserNotFound(t *testing.T, rps repository.Repository) {
+	if authUser, err := rps.GetAuthUser(allTenants(), newAuthUser().Email); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetAuthUser of missing email returned %+v, %v, want %v", authUser, err, repository.ErrNotFound)
+	}
+	if authUser, err := rps.GetAuthUserByID(allTenants(), uuid.New().String()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetAuthUserByID of missing user returned %+v, %v, want %v", authUser, err, repository.ErrNotFound)
+	}
+	if err := rps.UpdateAuthUser(allTenants(), newAuthUser().Email, "token"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("UpdateAuthUser of missing email returned %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func testSaveAuthUserDuplicate(t *testing.T, rps repository.Repository) {
+	authUser := newAuthUser()
+	mustSaveAuthUser(t, rps, authUser)
+	duplicate := *authUser
+	duplicate.UserName = "duplicate"
+	duplicate.UserUUID = ""
+	if err := rps.SaveAuthUser(allTenants(), &duplicate); !errors.Is(err, repository.ErrConflict) {
+		t.Fatalf("SaveAuthUser of duplicate email returned %v, want %v", err, repository.ErrConflict)
+	}
+}
+
+func testUpdateAuthUser(t *testing.T, rps repository.Repository) {
+	saved := mustSaveAuthUser(t, rps, newAuthUser())
+	const refreshToken = "refresh-token"
+	if err := rps.UpdateAuthUser(allTenants(), saved.Email, refreshToken); err != nil {
+		t.Fatalf("UpdateAuthUser failed - %v", err)
+	}
+	byID, err := rps.GetAuthUserByID(allTenants(), saved.UserUUID)
+	if err != nil {
+		t.Fatalf("GetAuthUserByID failed - %v", err)
+	}
+	if byID.RefreshToken != refreshToken {
+		t.Errorf("refresh token mismatch: got %q, want %q", byID.RefreshToken, refreshToken)
+	}
+	if err := rps.UpdateAuthUser(allTenants(), saved.Email, ""); err != nil {
+		t.Fatalf("UpdateAuthUser with empty token failed - %v", err)
+	}
+	byID, err = rps.GetAuthUserByID(allTenants(), saved.UserUUID)
+	if err != nil {
+		t.Fatalf("GetAuthUserByID failed - %v", err)
+	}
+	if byID.RefreshToken != "" {
+		t.Errorf("refresh token was not cleared: got %q", byID.RefreshToken)
+	}
+}
+
+func testGetOrdersPages(t *testing.T, rps repository.Repository) {
+	want := make(map[string]model.Order)
+	for i := 0; i < pageSize*2+1; i++ {
+		order := newOrder()
+		mustSave(t, rps, order)
+		want[order.OrderID] = *order
+	}
+	afterID := ""
+	for {
+		page, err := rps.GetOrders(allTenants(), afterID, pageSize)
+		if err != nil {
+			t.Fatalf("GetOrders(%q) failed - %v", afterID, err)
+		}
+		if len(page) > pageSize {
+			t.Fatalf("GetOrders returned %d orders, limit is %d", len(page), pageSize)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, order := range page {
+			if order.OrderID <= afterID {
+				t.Fatalf("GetOrders returned %q after %q, want ascending order", order.OrderID, afterID)
+			}
+			afterID = order.OrderID
+			if saved, found := want[order.OrderID]; found {
+				assertOrder(t, order, &saved)
+				delete(want, order.OrderID)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("GetOrders didn't return %d saved orders", len(want))
+	}
+}
+
+func testGetRecentOrdersPages(t *testing.T, rps repository.Repository) {
+	want := make(map[string]model.Order)
+	for i := 0; i < pageSize*2+1; i++ {
+		order := newOrder()
+		// pairs of orders share update time, so ties are paged by OrderID
+		order.UpdatedAt = int64(1000 + i/2)
+		mustSave(t, rps, order)
+		want[order.OrderID] = *order
+	}
+	var beforeUpdatedAt int64
+	beforeID := ""
+	for {
+		page, err := rps.GetRecentOrders(allTenants(), beforeUpdatedAt, beforeID, pageSize)
+		if err != nil {
+			t.Fatalf("GetRecentOrders(%d, %q) failed - %v", beforeUpdatedAt, beforeID, err)
+		}
+		if len(page) > pageSize {
+			t.Fatalf("GetRecentOrders returned %d orders, limit is %d", len(page), pageSize)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, order := range page {
+			if beforeID != "" && (order.UpdatedAt > beforeUpdatedAt || order.UpdatedAt == beforeUpdatedAt && order.OrderID >= beforeID) {
+				t.Fatalf("GetRecentOrders returned %d/%q after %d/%q, want descending order",
+					order.UpdatedAt, order.OrderID, beforeUpdatedAt, beforeID)
+			}
+			beforeUpdatedAt, beforeID = order.UpdatedAt, order.OrderID
+			if saved, found := want[order.OrderID]; found {
+				assertOrder(t, order, &saved)
+				delete(want, order.OrderID)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("GetRecentOrders didn't return %d saved orders", len(want))
+	}
+}
+
+func testGetAuthUsersPages(t *testing.T, rps repository.Repository) {
+	want := make(map[string]string)
+	for i := 0; i < pageSize*2+1; i++ {
+		saved := mustSaveAuthUser(t, rps, newAuthUser())
+		want[saved.UserUUID] = saved.Email
+	}
+	afterID := ""
+	for {
+		page, err := rps.GetAuthUsers(allTenants(), afterID, pageSize)
+		if err != nil {
+			t.Fatalf("GetAuthUsers(%q) failed - %v", afterID, err)
+		}
+		if len(page) > pageSize {
+			t.Fatalf("GetAuthUsers returned %d users, limit is %d", len(page), pageSize)
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, authUser := range page {
+			if authUser.UserUUID <= afterID {
+				t.Fatalf("GetAuthUsers returned %q after %q, want ascending order", authUser.UserUUID, afterID)
+			}
+			afterID = authUser.UserUUID
+			if email, found := want[authUser.UserUUID]; found {
+				if authUser.Email != email {
+					t.Errorf("authUser %q email mismatch: got %q, want %q", authUser.UserUUID, authUser.Email, email)
+				}
+				delete(want, authUser.UserUUID)
+			}
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("GetAuthUsers didn't return %d saved users", len(want))
+	}
+}
+
+func testConcurrentSaveAndGet(t *testing.T, rps repository.Repository) {
+	orders := make([]*model.Order, concurrentWorkers)
+	for i := range orders {
+		orders[i] = newOrder()
+	}
+	errs := make(chan error, 2*concurrentWorkers)
+	var wg sync.WaitGroup
+	for _, order := range orders {
+		wg.Add(1)
+		go func(order *model.Order) {
+			defer wg.Done()
+			if err := rps.Save(allTenants(), order); err != nil {
+				errs <- err
+				return
+			}
+			got, err := rps.Get(allTenants(), order.OrderID)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if *got != *order {
+				errs <- fmt.Errorf("order mismatch: got %+v, want %+v", *got, *order)
+			}
+		}(order)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func testConcurrentUpdate(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	mustSave(t, rps, order)
+	errs := make(chan error, concurrentWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrentWorkers; i++ {
+		wg.Add(1)
+		go func(cost int) {
+			defer wg.Done()
+			if err := rps.Update(allTenants(), &model.Order{
+				OrderID:   order.OrderID,
+				OrderName: order.OrderName,
+				OrderCost: cost,
+			}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	got := mustGet(t, rps, order.OrderID)
+	if got.OrderCost < 0 || got.OrderCost >= concurrentWorkers {
+		t.Errorf("order cost %d was not written by any update", got.OrderCost)
+	}
+}
+
+func testTransactionCommit(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	authUser := newAuthUser()
+	err := rps.WithinTransaction(allTenants(), func(ctx context.Context, tx repository.Repository) error {
+		if err := tx.Save(ctx, order); err != nil {
+			return err
+		}
+		if _, err := tx.Get(ctx, order.OrderID); err != nil {
+			return fmt.Errorf("order isn't visible inside transaction - %w", err)
+		}
+		return tx.SaveAuthUser(ctx, authUser)
+	})
+	if err != nil {
+		t.Fatalf("WithinTransaction failed - %v", err)
+	}
+	assertOrder(t, mustGet(t, rps, order.OrderID), order)
+	if _, err := rps.GetAuthUser(allTenants(), authUser.Email); err != nil {
+		t.Errorf("authUser wasn't committed - %v", err)
+	}
+}
+
+func testTransactionRollbackOnError(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	errAbort := errors.New("abort")
+	err := rps.WithinTransaction(allTenants(), func(ctx context.Context, tx repository.Repository) error {
+		if err := tx.Save(ctx, order); err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("WithinTransaction returned %v, want %v", err, errAbort)
+	}
+	if got, err := rps.Get(allTenants(), order.OrderID); err == nil {
+		t.Fatalf("order %+v was saved by rolled back transaction", got)
+	}
+}
+
+func testTransactionRollbackOnPanic(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Error("WithinTransaction didn't propagate panic")
+			}
+		}()
+		_ = rps.WithinTransaction(allTenants(), func(ctx context.Context, tx repository.Repository) error {
+			if err := tx.Save(ctx, order); err != nil {
+				return err
+			}
+			panic("abort")
+		})
+	}()
+	if got, err := rps.Get(allTenants(), order.OrderID); err == nil {
+		t.Fatalf("order %+v was saved by panicked transaction", got)
+	}
+}
+
+func testTenantIsolation(t *testing.T, rps repository.Repository) {
+	ctxA := tenant.WithID(context.Background(), "tenant-a")
+	ctxB := tenant.WithID(context.Background(), "tenant-b")
+	order := newOrder()
+	if err := rps.Save(ctxA, order); err != nil {
+		t.Fatalf("Save failed - %v", err)
+	}
+	if order.TenantID != "tenant-a" {
+		t.Errorf("Save set tenant %q, want %q", order.TenantID, "tenant-a")
+	}
+	if got, err := rps.Get(ctxA, order.OrderID); err != nil || got.TenantID != "tenant-a" {
+		t.Errorf("Get by owner tenant returned %+v, %v", got, err)
+	}
+	if got, err := rps.Get(ctxB, order.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get by other tenant returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	updated := *order
+	updated.OrderName = "updated"
+	if err := rps.Update(ctxB, &updated); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Update by other tenant returned %v, want %v", err, repository.ErrNotFound)
+	}
+	if err := rps.Delete(ctxB, order.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Delete by other tenant returned %v, want %v", err, repository.ErrNotFound)
+	}
+	orders, err := rps.GetOrders(ctxB, "", 100)
+	if err != nil {
+		t.Fatalf("GetOrders failed - %v", err)
+	}
+	for _, o := range orders {
+		if o.OrderID == order.OrderID {
+			t.Errorf("GetOrders by other tenant returned order %s", order.OrderID)
+		}
+	}
+	assertOrder(t, mustGet(t, rps, order.OrderID), order)
+	if err := rps.Delete(ctxA, order.OrderID); err != nil {
+		t.Errorf("Delete by owner tenant failed - %v", err)
+	}
+}
+
+func testTenantAuthUserIsolation(t *testing.T, rps repository.Repository) {
+	ctxA := tenant.WithID(context.Background(), "tenant-a")
+	ctxB := tenant.WithID(context.Background(), "tenant-b")
+	authUser := newAuthUser()
+	if err := rps.SaveAuthUser(ctxA, authUser); err != nil {
+		t.Fatalf("SaveAuthUser failed - %v", err)
+	}
+	if _, err := rps.GetAuthUser(ctxA, authUser.Email); err != nil {
+		t.Errorf("GetAuthUser by owner tenant failed - %v", err)
+	}
+	if got, err := rps.GetAuthUser(ctxB, authUser.Email); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetAuthUser by other tenant returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	if got, err := rps.GetAuthUserByID(ctxB, authUser.UserUUID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetAuthUserByID by other tenant returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	if err := rps.UpdateAuthUser(ctxB, authUser.Email, "token"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("UpdateAuthUser by other tenant returned %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func testUnscopedContextRefused(t *testing.T, rps repository.Repository) {
+	order := newOrder()
+	if err := rps.Save(allTenants(), order); err != nil {
+		t.Fatalf("Save failed - %v", err)
+	}
+	for _, ctx := range []context.Context{context.Background(), tenant.WithID(context.Background(), "")} {
+		if got, err := rps.Get(ctx, order.OrderID); !errors.Is(err, repository.ErrNoTenantScope) {
+			t.Errorf("Get without tenant scope returned %+v, %v, want %v", got, err, repository.ErrNoTenantScope)
+		}
+		if _, err := rps.GetOrders(ctx, "", 100); !errors.Is(err, repository.ErrNoTenantScope) {
+			t.Errorf("GetOrders without tenant scope returned %v, want %v", err, repository.ErrNoTenantScope)
+		}
+		if err := rps.Delete(ctx, order.OrderID); !errors.Is(err, repository.ErrNoTenantScope) {
+			t.Errorf("Delete without tenant scope returned %v, want %v", err, repository.ErrNoTenantScope)
+		}
+		if err := rps.Save(ctx, newOrder()); !errors.Is(err, repository.ErrNoTenantScope) {
+			t.Errorf("Save without tenant scope returned %v, want %v", err, repository.ErrNoTenantScope)
+		}
+	}
+	assertOrder(t, mustGet(t, rps, order.OrderID), order)
+}
+
+func testSaveAndUpdateTenant(t *testing.T, rps repository.Repository) {
+	ctx := allTenants()
+	if _, err := rps.GetTenant(ctx, tenant.DefaultID); err != nil {
+		t.Errorf("GetTenant of default tenant failed - %v", err)
+	}
+	tnt := &model.Tenant{TenantID: "tenant-" + uuid.New().String()[:8], Name: "tenant"}
+	if err := rps.SaveTenant(ctx, tnt); err != nil {
+		t.Fatalf("SaveTenant failed - %v", err)
+	}
+	if err := rps.SaveTenant(ctx, tnt); !errors.Is(err, repository.ErrConflict) {
+		t.Errorf("SaveTenant of duplicate returned %v, want %v", err, repository.ErrConflict)
+	}
+	tnt.Disabled = true
+	if err := rps.UpdateTenant(ctx, tnt); err != nil {
+		t.Fatalf("UpdateTenant failed - %v", err)
+	}
+	got, err := rps.GetTenant(ctx, tnt.TenantID)
+	if err != nil {
+		t.Fatalf("GetTenant failed - %v", err)
+	}
+	if *got != *tnt {
+		t.Errorf("tenant mismatch: got %+v, want %+v", *got, *tnt)
+	}
+	if got, err := rps.GetTenant(ctx, uuid.New().String()); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetTenant of missing tenant returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	if err := rps.UpdateTenant(ctx, &model.Tenant{TenantID: uuid.New().String()}); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("UpdateTenant of missing tenant returned %v, want %v", err, repository.ErrNotFound)
+	}
+}
+
+func testArchiveOrders(t *testing.T, rps repository.Repository) {
+	ctx := allTenants()
+	old := newOrder()
+	old.IsDelivered, old.DeliveredAt = true, 100
+	recent := newOrder()
+	recent.IsDelivered, recent.DeliveredAt = true, 2000
+	undelivered := newOrder()
+	for _, order := range []*model.Order{old, recent, undelivered} {
+		mustSave(t, rps, order)
+	}
+	archived, err := rps.ArchiveOrders(ctx, 1000, 10)
+	if err != nil {
+		t.Fatalf("ArchiveOrders failed - %v", err)
+	}
+	if len(archived) != 1 {
+		t.Fatalf("ArchiveOrders moved %d orders, want 1", len(archived))
+	}
+	assertOrder(t, archived[0], old)
+	if got, err := rps.Get(ctx, old.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Get of archived order returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	got, err := rps.GetArchivedOrder(ctx, old.OrderID)
+	if err != nil {
+		t.Fatalf("GetArchivedOrder failed - %v", err)
+	}
+	assertOrder(t, got, old)
+	other := tenant.WithID(ctx, "tenant-other")
+	if got, err := rps.GetArchivedOrder(other, old.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetArchivedOrder by other tenant returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	if got, err := rps.GetArchivedOrder(ctx, recent.OrderID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("GetArchivedOrder of live order returned %+v, %v, want %v", got, err, repository.ErrNotFound)
+	}
+	assertOrder(t, mustGet(t, rps, recent.OrderID), recent)
+	assertOrder(t, mustGet(t, rps, undelivered.OrderID), undelivered)
+	if archived, err := rps.ArchiveOrders(ctx, 1000, 10); err != nil || len(archived) != 0 {
+		t.Errorf("repeated ArchiveOrders returned %d orders, %v, want none", len(archived), err)
+	}
+}
+
+func testSaveArchivedOrderAndPages(t *testing.T, rps repository.Repository) {
+	ctx := allTenants()
+	want := make(map[string]*model.Order)
+	var last *model.Order
+	for i := 0; i < 5; i++ {
+		order := newOrder()
+		order.IsDelivered, order.DeliveredAt = true, 100
+		if err := rps.SaveArchivedOrder(ctx, order); err != nil {
+			t.Fatalf("SaveArchivedOrder failed - %v", err)
+		}
+		want[order.OrderID] = order
+		last = order
+	}
+	replaced := *last
+	replaced.OrderName = "replaced"
+	if err := rps.SaveArchivedOrder(ctx, &replaced); err != nil {
+		t.Fatalf("SaveArchivedOrder of existing order failed - %v", err)
+	}
+	want[replaced.OrderID] = &replaced
+	afterID := ""
+	for {
+		orders, err := rps.GetArchivedOrders(ctx, afterID, 2)
+		if err != nil {
+			t.Fatalf("GetArchivedOrders failed - %v", err)
+		}
+		for _, order := range orders {
+			if order.OrderID <= afterID {
+				t.Fatalf("GetArchivedOrders returned %s after %s", order.OrderID, afterID)
+			}
+			if w, ok := want[order.OrderID]; ok {
+				assertOrder(t, order, w)
+				delete(want, order.OrderID)
+			}
+			afterID = order.OrderID
+		}
+		if len(orders) < 2 {
+			break
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("GetArchivedOrders missed %d orders", len(want))
+	}
+}
+
+func testGetTenantsPages(t *testing.T, rps repository.Repository) {
+	ctx := allTenants()
+	want := map[string]bool{tenant.DefaultID: true}
+	for i := 0; i < 3; i++ {
+		tnt := &model.Tenant{TenantID: "tenant-" + uuid.New().String()[:8], Name: "tenant"}
+		if err := rps.SaveTenant(ctx, tnt); err != nil {
+			t.Fatalf("SaveTenant failed - %v", err)
+		}
+		want[tnt.TenantID] = true
+	}
+	afterID := ""
+	for {
+		tenants, err := rps.GetTenants(ctx, afterID, 2)
+		if err != nil {
+			t.Fatalf("GetTenants failed - %v", err)
+		}
+		for _, tnt := range tenants {
+			if tnt.TenantID <= afterID {
+				t.Fatalf("GetTenants returned %s after %s", tnt.TenantID, afterID)
+			}
+			delete(want, tnt.TenantID)
+			afterID = tnt.TenantID
+		}
+		if len(tenants) < 2 {
+			break
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("GetTenants missed tenants %v", want)
+	}
+}
@@ -0,0 +1,618 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+
+	"github.com/google/uuid"
+	// sqlite3 also registers driver for database/sql
+	"github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+)
+
+// SqliteRepository type replies for accessing to sqlite database
+type SqliteRepository struct {
+	DBconn *sql.DB
+	tx     *sql.Tx
+}
+
+// sqlQuerier is implemented by both sql.DB and sql.Tx
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// db returns current transaction if repository is bound to it, else database
+func (rps *SqliteRepository) db() sqlQuerier {
+	if rps.tx != nil {
+		return rps.tx
+	}
+	return rps.DBconn
+}
+
+// NewSqliteRepository opens sqlite database by url and applies shared
+// sql migrations to it
+func NewSqliteRepository(ctx context.Context, url string) (*SqliteRepository, error) {
+	conn, err := sql.Open("sqlite3", url)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite repository: can't open database - %w", err)
+	}
+	// sqlite allows only one writer, and every connection to ":memory:"
+	// opens its own database, so one connection is shared by all calls
+	conn.SetMaxOpenConns(1)
+	rps := &SqliteRepository{DBconn: conn}
+	if err := rps.Migrate(ctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return rps, nil
+}
+
+// Save save Order object into sqlite database
+func (rps *SqliteRepository) Save(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID":   order.OrderID,
+		"orderName": order.OrderName,
+	}).Debugf("sqlite repository: create order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	_, err = rps.db().ExecContext(ctx, `insert into orders (orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat)
+		values (?, ?, ?, ?, ?, ?, ?)`, order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, order.TenantID, order.DeliveredAt, order.UpdatedAt)
+	if err != nil {
+		return sqliteError("can't save order", err)
+	}
+	return nil
+}
+
+// Get method returns Order object from sqlite database
+// with selection by OrderID
+func (rps *SqliteRepository) Get(ctx context.Context, orderID string) (*model.Order, error) {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("sqlite repository: get order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var order model.Order
+	err = rps.db().QueryRowContext(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders
+		where orderID=?1 and (?2 = '' or tenantid = ?2)`, orderID, scope).Scan(
+		&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt)
+	if err != nil {
+		return nil, sqliteError("can't get order", err)
+	}
+	return &order, nil
+}
+
+// Update method update Order object from sqlite database
+// with selection by OrderID
+func (rps *SqliteRepository) Update(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID":   order.OrderID,
+		"orderName": order.OrderName,
+	}).Debugf("sqlite repository: update order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := rps.db().ExecContext(ctx, `update orders
+		set orderName=?1, orderCost=?2, isDelivered=?3, deliveredat=?6, updatedat=?7
+		where orderID=?4 and (?5 = '' or tenantid = ?5)`, order.OrderName, order.OrderCost, order.IsDelivered, order.OrderID, scope,
+		order.DeliveredAt, order.UpdatedAt)
+	if err != nil {
+		return sqliteError("can't update order", err)
+	}
+	return affectedOne(result, "sqlite repository: can't update order - order %s not found", order.OrderID)
+}
+
+// Delete method delete Order object from sqlite database
+// with selection by OrderID
+func (rps *SqliteRepository) Delete(ctx context.Context, orderID string) error {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("sqlite repository: delete order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := rps.db().ExecContext(ctx, "delete from orders where orderID=?1 and (?2 = '' or tenantid = ?2)", orderID, scope)
+	if err != nil {
+		return sqliteError("can't delete order", err)
+	}
+	return affectedOne(result, "sqlite repository: can't delete order - order %s not found", orderID)
+}
+
+// SaveAuthUser method saves authentication info about user into
+// sqlite database
+func (rps *SqliteRepository) SaveAuthUser(ctx context.Context, authUser *model.AuthUser) error {
+	log.WithFields(log.Fields{
+		"userID":   authUser.UserUUID,
+		"userName": authUser.UserName,
+	}).Debugf("sqlite repository: save authUser")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	if authUser.UserUUID == "" {
+		authUser.UserUUID = uuid.New().String()
+	}
+	authUser.TenantID = ownerTenant(scope, authUser.TenantID)
+	_, err = rps.db().ExecContext(ctx, `insert into authusers (useruuid, username, email, password, tenantid)
+		values(?, ?, ?, ?, ?)`, authUser.UserUUID, authUser.UserName, authUser.Email, authUser.Password, authUser.TenantID)
+	if err != nil {
+		return sqliteError("can't save authUser", err)
+	}
+	return nil
+}
+
+// GetAuthUser method returns authentication info about user from
+// sqlite database with selection by email
+func (rps *SqliteRepository) GetAuthUser(ctx context.Context, email string) (*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"email": email,
+	}).Debugf("sqlite repository: get authUser by email")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var authUser model.AuthUser
+	err = rps.db().QueryRowContext(ctx, `select useruuid, username, email, password, tenantid from authusers
+		where email=?1 and (?2 = '' or tenantid = ?2)`, email, scope).Scan(
+		&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.TenantID)
+	if err != nil {
+		return nil, sqliteError("can't get authUser", err)
+	}
+	return &authUser, nil
+}
+
+// GetAuthUserByID method returns authentication info about user from
+// sqlite database with selection by id
+func (rps *SqliteRepository) GetAuthUserByID(ctx context.Context, userUUID string) (*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"userID": userUUID,
+	}).Debugf("sqlite repository: get authUser by id")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var authUser model.AuthUser
+	err = rps.db().QueryRowContext(ctx, `select useruuid, username, email, password, refreshtoken, tenantid from authusers
+		where useruuid=?1 and (?2 = '' or tenantid = ?2)`, userUUID, scope).Scan(
+		&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password, &authUser.RefreshToken, &authUser.TenantID)
+	if err != nil {
+		return nil, sqliteError("can't get authUser by ID", err)
+	}
+	return &authUser, nil
+}
+
+// UpdateAuthUser is method to set refresh token into authuser info
+func (rps *SqliteRepository) UpdateAuthUser(ctx context.Context, email, refreshToken string) error {
+	log.WithFields(log.Fields{
+		"email": email,
+	}).Debugf("sqlite repository: update authUser")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	result, err := rps.db().ExecContext(ctx, `update authusers
+		set refreshtoken=?1
+		where email=?2 and (?3 = '' or tenantid = ?3)`, refreshToken, email, scope)
+	if err != nil {
+		return sqliteError("can't update authUser", err)
+	}
+	return affectedOne(result, "sqlite repository: can't update authUser - email %s not found", email)
+}
+
+// GetOrders method returns up to limit orders with OrderID greater than
+// afterID ordered by OrderID, so orders can be read page by page
+func (rps *SqliteRepository) GetOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("sqlite repository: get orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rps.db().QueryContext(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders
+		where orderID > ?1 and (?3 = '' or tenantid = ?3)
+		order by orderID limit ?2`, afterID, limit, scope)
+	if err != nil {
+		return nil, sqliteError("can't get orders", err)
+	}
+	defer rows.Close()
+	var orders []*model.Order
+	for rows.Next() {
+		var order model.Order
+		if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+			return nil, sqliteError("can't get orders", err)
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError("can't get orders", err)
+	}
+	return orders, nil
+}
+
+// GetRecentOrders method returns up to limit orders updated before order
+// identified by beforeUpdatedAt and beforeID, most recently updated first.
+// Empty beforeID starts from the most recently updated order
+func (rps *SqliteRepository) GetRecentOrders(ctx context.Context, beforeUpdatedAt int64, beforeID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"beforeUpdatedAt": beforeUpdatedAt,
+		"beforeID":        beforeID,
+		"limit":           limit,
+	}).Debugf("sqlite repository: get recent orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rps.db().QueryContext(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders
+		where (?2 = '' or updatedat < ?1 or (updatedat = ?1 and orderID < ?2)) and (?4 = '' or tenantid = ?4)
+		order by updatedat desc, orderID desc limit ?3`, beforeUpdatedAt, beforeID, limit, scope)
+	if err != nil {
+		return nil, sqliteError("can't get recent orders", err)
+	}
+	defer rows.Close()
+	var orders []*model.Order
+	for rows.Next() {
+		var order model.Order
+		if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+			return nil, sqliteError("can't get recent orders", err)
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError("can't get recent orders", err)
+	}
+	return orders, nil
+}
+
+// GetAuthUsers method returns up to limit users with UserUUID greater than
+// afterID ordered by UserUUID
+func (rps *SqliteRepository) GetAuthUsers(ctx context.Context, afterID string, limit int) ([]*model.AuthUser, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("sqlite repository: get authUsers")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rps.db().QueryContext(ctx, `select useruuid, username, email, password, refreshtoken, tenantid from authusers
+		where useruuid > ?1 and (?3 = '' or tenantid = ?3)
+		order by useruuid limit ?2`, afterID, limit, scope)
+	if err != nil {
+		return nil, sqliteError("can't get authUsers", err)
+	}
+	defer rows.Close()
+	var authUsers []*model.AuthUser
+	for rows.Next() {
+		var authUser model.AuthUser
+		if err := rows.Scan(&authUser.UserUUID, &authUser.UserName, &authUser.Email, &authUser.Password,
+			&authUser.RefreshToken, &authUser.TenantID); err != nil {
+			return nil, sqliteError("can't get authUsers", err)
+		}
+		authUsers = append(authUsers, &authUser)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError("can't get authUsers", err)
+	}
+	return authUsers, nil
+}
+
+// SaveTenant method saves tenant into sqlite database
+func (rps *SqliteRepository) SaveTenant(ctx context.Context, t *model.Tenant) error {
+	log.WithFields(log.Fields{
+		"tenantID": t.TenantID,
+	}).Debugf("sqlite repository: save tenant")
+	_, err := rps.db().ExecContext(ctx, `insert into tenants (tenantid, name, disabled) values (?, ?, ?)`,
+		t.TenantID, t.Name, t.Disabled)
+	if err != nil {
+		return sqliteError("can't save tenant", err)
+	}
+	return nil
+}
+
+// GetTenant method returns tenant from sqlite database with selection by id
+func (rps *SqliteRepository) GetTenant(ctx context.Context, tenantID string) (*model.Tenant, error) {
+	log.WithFields(log.Fields{
+		"tenantID": tenantID,
+	}).Debugf("sqlite repository: get tenant")
+	var t model.Tenant
+	err := rps.db().QueryRowContext(ctx, `select tenantid, name, disabled from tenants where tenantid=?`, tenantID).Scan(
+		&t.TenantID, &t.Name, &t.Disabled)
+	if err != nil {
+		return nil, sqliteError("can't get tenant", err)
+	}
+	return &t, nil
+}
+
+// UpdateTenant method updates tenant name and state in sqlite database
+func (rps *SqliteRepository) UpdateTenant(ctx context.Context, t *model.Tenant) error {
+	log.WithFields(log.Fields{
+		"tenantID": t.TenantID,
+		"disabled": t.Disabled,
+	}).Debugf("sqlite repository: update tenant")
+	result, err := rps.db().ExecContext(ctx, `update tenants set name=?, disabled=? where tenantid=?`,
+		t.Name, t.Disabled, t.TenantID)
+	if err != nil {
+		return sqliteError("can't update tenant", err)
+	}
+	return affectedOne(result, "sqlite repository: can't update tenant - tenant %s not found", t.TenantID)
+}
+
+// ArchiveOrders method moves up to limit orders delivered before
+// deliveredBefore unix time from orders to archived_orders table and
+// returns moved orders
+func (rps *SqliteRepository) ArchiveOrders(ctx context.Context, deliveredBefore int64, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"deliveredBefore": deliveredBefore,
+		"limit":           limit,
+	}).Debugf("sqlite repository: archive orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var orders []*model.Order
+	err = rps.WithinTransaction(ctx, func(ctx context.Context, tx Repository) error {
+		db := tx.(*SqliteRepository).db()
+		orders = nil
+		rows, err := db.QueryContext(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from orders
+			where isDelivered and deliveredat > 0 and deliveredat < ?1 and (?3 = '' or tenantid = ?3)
+			order by orderID limit ?2`, deliveredBefore, limit, scope)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var order model.Order
+			if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+				rows.Close()
+				return err
+			}
+			orders = append(orders, &order)
+		}
+		if err := rows.Close(); err != nil {
+			return err
+		}
+		for _, order := range orders {
+			_, err := db.ExecContext(ctx, `insert or replace into archived_orders
+				(orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat) values (?, ?, ?, ?, ?, ?, ?)`,
+				order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, order.TenantID, order.DeliveredAt, order.UpdatedAt)
+			if err != nil {
+				return err
+			}
+			if _, err := db.ExecContext(ctx, "delete from orders where orderID=?", order.OrderID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, sqliteError("can't archive orders", err)
+	}
+	return orders, nil
+}
+
+// GetArchivedOrder method returns Order object from archived_orders table
+// with selection by OrderID
+func (rps *SqliteRepository) GetArchivedOrder(ctx context.Context, orderID string) (*model.Order, error) {
+	log.WithFields(log.Fields{
+		"orderID": orderID,
+	}).Debugf("sqlite repository: get archived order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var order model.Order
+	err = rps.db().QueryRowContext(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from archived_orders
+		where orderID=?1 and (?2 = '' or tenantid = ?2)`, orderID, scope).Scan(
+		&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt)
+	if err != nil {
+		return nil, sqliteError("can't get archived order", err)
+	}
+	return &order, nil
+}
+
+// GetArchivedOrders method returns up to limit archived orders with OrderID
+// greater than afterID ordered by OrderID
+func (rps *SqliteRepository) GetArchivedOrders(ctx context.Context, afterID string, limit int) ([]*model.Order, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("sqlite repository: get archived orders")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := rps.db().QueryContext(ctx, `select orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat from archived_orders
+		where orderID > ?1 and (?3 = '' or tenantid = ?3)
+		order by orderID limit ?2`, afterID, limit, scope)
+	if err != nil {
+		return nil, sqliteError("can't get archived orders", err)
+	}
+	defer rows.Close()
+	var orders []*model.Order
+	for rows.Next() {
+		var order model.Order
+		if err := rows.Scan(&order.OrderID, &order.OrderName, &order.OrderCost, &order.IsDelivered, &order.TenantID, &order.DeliveredAt, &order.UpdatedAt); err != nil {
+			return nil, sqliteError("can't get archived orders", err)
+		}
+		orders = append(orders, &order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError("can't get archived orders", err)
+	}
+	return orders, nil
+}
+
+// SaveArchivedOrder method saves order into archived_orders table, archived
+// order with the same OrderID is replaced
+func (rps *SqliteRepository) SaveArchivedOrder(ctx context.Context, order *model.Order) error {
+	log.WithFields(log.Fields{
+		"orderID": order.OrderID,
+	}).Debugf("sqlite repository: save archived order")
+	scope, err := tenantScope(ctx)
+	if err != nil {
+		return err
+	}
+	order.TenantID = ownerTenant(scope, order.TenantID)
+	_, err = rps.db().ExecContext(ctx, `insert or replace into archived_orders
+		(orderID, orderName, orderCost, isDelivered, tenantid, deliveredat, updatedat) values (?, ?, ?, ?, ?, ?, ?)`,
+		order.OrderID, order.OrderName, order.OrderCost, order.IsDelivered, order.TenantID, order.DeliveredAt, order.UpdatedAt)
+	if err != nil {
+		return sqliteError("can't save archived order", err)
+	}
+	return nil
+}
+
+// GetTenants method returns up to limit tenants with TenantID greater than
+// afterID ordered by TenantID
+func (rps *SqliteRepository) GetTenants(ctx context.Context, afterID string, limit int) ([]*model.Tenant, error) {
+	log.WithFields(log.Fields{
+		"afterID": afterID,
+		"limit":   limit,
+	}).Debugf("sqlite repository: get tenants")
+	rows, err := rps.db().QueryContext(ctx, `select tenantid, name, disabled from tenants
+		where tenantid > ? order by tenantid limit ?`, afterID, limit)
+	if err != nil {
+		return nil, sqliteError("can't get tenants", err)
+	}
+	defer rows.Close()
+	var tenants []*model.Tenant
+	for rows.Next() {
+		var t model.Tenant
+		if err := rows.Scan(&t.TenantID, &t.Name, &t.Disabled); err != nil {
+			return nil, sqliteError("can't get tenants", err)
+		}
+		tenants = append(tenants, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError("can't get tenants", err)
+	}
+	return tenants, nil
+}
+
+// WithinTransaction method runs fn inside sqlite transaction. If repository
+// is already bound to transaction, fn joins it. Since the only connection
+// is held by transaction, fn must not use repository it was called on
+func (rps *SqliteRepository) WithinTransaction(ctx context.Context, fn TxFunc) (err error) {
+	if rps.tx != nil {
+		return fn(ctx, rps)
+	}
+	tx, err := rps.DBconn.BeginTx(ctx, nil)
+	if err != nil {
+		return sqliteError("can't begin transaction", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil && !errors.Is(rbErr, sql.ErrTxDone) {
+				log.Errorf("sqlite repository: can't rollback transaction - %e", rbErr)
+			}
+		}
+	}()
+	if err = fn(ctx, &SqliteRepository{DBconn: rps.DBconn, tx: tx}); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return sqliteError("can't commit transaction", err)
+	}
+	return nil
+}
+
+// Migrate method applies shared sql migrations which weren't applied yet
+func (rps *SqliteRepository) Migrate(ctx context.Context) error {
+	migrations, err := loadMigrations("sqlite")
+	if err != nil {
+		return err
+	}
+	if _, err := rps.DBconn.ExecContext(ctx, migrationsTable); err != nil {
+		return fmt.Errorf("sqlite repository: can't create migrations table - %w", err)
+	}
+	for _, m := range migrations {
+		if err := rps.applyMigration(ctx, m); err != nil {
+			return fmt.Errorf("sqlite repository: can't apply migration %s - %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+func (rps *SqliteRepository) applyMigration(ctx context.Context, m migration) error {
+	tx, err := rps.DBconn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	result, err := tx.ExecContext(ctx, `insert or ignore into schema_migrations (version) values (?)`, m.version)
+	if err != nil {
+		return err
+	}
+	if applied, err := result.RowsAffected(); err != nil || applied == 0 {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"version": m.version,
+	}).Info("sqlite repository: apply migration")
+	if _, err := tx.ExecContext(ctx, m.query); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CloseDBConnection is using to close current sqlite database connection
+func (rps *SqliteRepository) CloseDBConnection() error {
+	if rps.tx != nil {
+		return fmt.Errorf("sqlite repository: can't close database connection inside transaction")
+	}
+	if err := rps.DBconn.Close(); err != nil {
+		return fmt.Errorf("sqlite repository: can't close database connection - %w", err)
+	}
+	return nil
+}
+
+// sqliteError wraps sqlite error into repository Error of matching kind
+func sqliteError(message string, err error) error {
+	var sqliteErr sqlite3.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return NewError(ErrNotFound, "sqlite repository: %s - %w", message, err)
+	case errors.As(err, &sqliteErr):
+		switch {
+		case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique, sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey:
+			return NewError(ErrConflict, "sqlite repository: %s - %w", message, err)
+		case sqliteErr.Code == sqlite3.ErrConstraint, sqliteErr.Code == sqlite3.ErrMismatch, sqliteErr.Code == sqlite3.ErrTooBig:
+			return NewError(ErrValidation, "sqlite repository: %s - %w", message, err)
+		case sqliteErr.Code == sqlite3.ErrBusy, sqliteErr.Code == sqlite3.ErrLocked,
+			sqliteErr.Code == sqlite3.ErrCantOpen, sqliteErr.Code == sqlite3.ErrFull, sqliteErr.Code == sqlite3.ErrIoErr:
+			return NewError(ErrUnavailable, "sqlite repository: %s - %w", message, err)
+		}
+	}
+	return fmt.Errorf("sqlite repository: %s - %w", message, err)
+}
+
+// affectedOne returns not found error formatted by format when statement
+// didn't change any row
+func affectedOne(result sql.Result, format string, a ...interface{}) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("sqlite repository: can't get affected rows - %w", err)
+	}
+	if affected == 0 {
+		return NewError(ErrNotFound, format, a...)
+	}
+	return nil
+}
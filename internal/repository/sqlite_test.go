@@ -0,0 +1,24 @@
+package repository_test
+
+import (
+	"context"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/repository/repotest"
+	"path/filepath"
+	"testing"
+)
+
+func TestSqliteRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) repository.Repository {
+		rps, err := repository.NewSqliteRepository(context.Background(), filepath.Join(t.TempDir(), "crudserver.db"))
+		if err != nil {
+			t.Fatalf("can't open sqlite database - %v", err)
+		}
+		t.Cleanup(func() {
+			if err := rps.CloseDBConnection(); err != nil {
+				t.Errorf("can't close sqlite database - %v", err)
+			}
+		})
+		return rps
+	})
+}
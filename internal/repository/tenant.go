@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+)
+
+// ErrNoTenantScope is returned when ctx carries neither tenant nor all
+// tenants mark, such call is refused instead of seeing data of all tenants
+var ErrNoTenantScope = errors.New("repository: context has no tenant scope")
+
+// tenantScope returns tenant which query is limited to. Empty string means
+// ctx is marked by tenant.AllTenants and query sees data of all tenants
+func tenantScope(ctx context.Context) (string, error) {
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		if tenantID == "" {
+			return "", ErrNoTenantScope
+		}
+		return tenantID, nil
+	}
+	if tenant.IsAllTenants(ctx) {
+		return "", nil
+	}
+	return "", ErrNoTenantScope
+}
+
+// ownerTenant returns tenant which saved entity belongs to: tenant of scope
+// if it is set, else tenant stored in entity, else default tenant
+func ownerTenant(scope, entityTenant string) string {
+	if scope != "" {
+		return scope
+	}
+	if entityTenant != "" {
+		return entityTenant
+	}
+	return tenant.DefaultID
+}
+
+// visible reports whether entity of entityTenant can be seen in scope
+func visible(scope, entityTenant string) bool {
+	return scope == "" || scope == entityTenant
+}
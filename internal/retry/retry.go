@@ -0,0 +1,117 @@
+// Package retry replies retrying of operations on unavailable dependencies
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Policy type describes how many times and how often operation is retried.
+// Delay before n-th retry is random value in [0, min(MaxBackoff, InitialBackoff*2^n)]
+type Policy struct {
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// Do function calls fn until it succeeds, attempts are exhausted or ctx is
+// done. Last fn error is returned
+func Do(ctx context.Context, name string, p Policy, fn func(context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if attempt >= p.Attempts {
+			return fmt.Errorf("retry: %s failed after %d attempts - %w", name, attempt, err)
+		}
+		delay := p.backoff(attempt)
+		log.WithFields(log.Fields{
+			"operation": name,
+			"attempt":   attempt,
+			"delay":     delay,
+			"err":       err,
+		}).Warn("retry: operation failed, retrying")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("retry: %s canceled - %w", name, err)
+		case <-time.After(delay):
+		}
+	}
+}
+
+// defaultWatchInterval is how often Watch pings dependency when interval
+// isn't positive
+const defaultWatchInterval = 10 * time.Second
+
+// Health type is state of dependency watched by Watch
+type Health struct {
+	name    string
+	healthy int32
+}
+
+// Name method returns name of dependency
+func (h *Health) Name() string {
+	return h.name
+}
+
+// Healthy method reports whether last ping of dependency succeeded
+func (h *Health) Healthy() bool {
+	return atomic.LoadInt32(&h.healthy) == 1
+}
+
+// Watch function pings dependency every interval, or every
+// defaultWatchInterval if interval isn't positive, until ctx is done. It
+// returns health of dependency, which is updated and logged when dependency
+// goes down and comes back. Clients of postgres, mongo and redis reconnect
+// on their own, pings keep them exercised
+func Watch(ctx context.Context, name string, interval time.Duration, ping func(context.Context) error) *Health {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	health := &Health{name: name, healthy: 1}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				pingCtx, cancel := context.WithTimeout(ctx, interval)
+				err := ping(pingCtx)
+				cancel()
+				healthy := err == nil
+				if healthy != health.Healthy() {
+					if healthy {
+						atomic.StoreInt32(&health.healthy, 1)
+					} else {
+						atomic.StoreInt32(&health.healthy, 0)
+					}
+					log.WithFields(log.Fields{
+						"dependency": name,
+						"healthy":    healthy,
+						"err":        err,
+					}).Warn("retry: dependency health changed")
+				}
+			}
+		}
+	}()
+	return health
+}
+
+func (p Policy) backoff(attempt int) time.Duration {
+	backoff := p.MaxBackoff
+	if shift := attempt - 1; shift < 32 && p.InitialBackoff<<shift > 0 && p.InitialBackoff<<shift < p.MaxBackoff {
+		backoff = p.InitialBackoff << shift
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
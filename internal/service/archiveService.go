@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ArchiveDelivered method moves orders delivered longer than olderThan ago
+// into archive in batches of batchSize and evicts them from cache. It
+// returns number of archived orders
+func (s Service) ArchiveDelivered(ctx context.Context, olderThan time.Duration, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("service: can't archive orders - %w", repository.NewError(repository.ErrValidation, "batch size must be positive"))
+	}
+	deliveredBefore := time.Now().Add(-olderThan).Unix()
+	archived := 0
+	for {
+		orders, err := s.rps.ArchiveOrders(ctx, deliveredBefore, batchSize)
+		if err != nil {
+			return archived, fmt.Errorf("service: can't archive orders - %w", err)
+		}
+		for _, order := range orders {
+			if err := s.orderCache.Delete(order.TenantID, order.OrderID); err != nil {
+				log.Errorf("service: can't evict archived order - %e", err)
+			}
+		}
+		archived += len(orders)
+		if len(orders) < batchSize {
+			return archived, nil
+		}
+	}
+}
+
+// RunArchiver method starts archiving delivered orders every interval until
+// ctx is done. Zero interval disables archiving
+func (s Service) RunArchiver(ctx context.Context, interval, olderThan time.Duration, batchSize int) {
+	if interval <= 0 {
+		return
+	}
+	if batchSize <= 0 {
+		log.Errorf("service: archiving disabled - batch size %d isn't positive", batchSize)
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				archived, err := s.ArchiveDelivered(ctx, olderThan, batchSize)
+				if err != nil {
+					log.Errorf("service: archiving failed - %e", err)
+				} else {
+					log.WithFields(log.Fields{
+						"archived": archived,
+					}).Info("service: delivered orders archived")
+				}
+			}
+		}
+	}()
+}
@@ -5,27 +5,36 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"github.com/EgorBessonov/CRUDServer/internal/cache"
 	"github.com/EgorBessonov/CRUDServer/internal/model"
 	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"golang.org/x/sync/singleflight"
 )
 
 // Service type
 type Service struct {
-	rps        repository.Repository
-	orderCache *cache.OrderCache
+	rps         repository.Repository
+	orderCache  *cache.OrderCache
+	readMetrics *ReadMetrics
+	reads       *singleflight.Group
 }
 
-// NewService method returns new Service instance
-func NewService(_rps repository.Repository, _orderCache *cache.OrderCache) *Service {
-	return &Service{rps: _rps, orderCache: _orderCache}
+// NewService method returns new Service instance. Nil readMetrics disables
+// order read metrics
+func NewService(_rps repository.Repository, _orderCache *cache.OrderCache, _readMetrics *ReadMetrics) *Service {
+	return &Service{rps: _rps, orderCache: _orderCache, readMetrics: _readMetrics, reads: &singleflight.Group{}}
 }
 
+// ErrUnauthorized is returned when credentials or refresh token are invalid
+var ErrUnauthorized = errors.New("unauthorized")
+
 const (
 	accessTokenExTime  = 15
 	refreshTokenExTime = 720
@@ -35,17 +44,39 @@ const (
 type CustomClaims struct {
 	email    string
 	userName string
+	TenantID string `json:"tenantID"`
 	jwt.StandardClaims
 }
 
-// Registration method hash user password and after that save user in repository
+// Registration method hash user password and after that save user in
+// repository. Self-registered users always belong to default tenant, users
+// of other tenants are registered by admin with RegisterTenantUser
 func (s Service) Registration(ctx context.Context, authUser *model.AuthUser) error {
+	return s.register(ctx, tenant.DefaultID, authUser)
+}
+
+// RegisterTenantUser method registers user in tenant on behalf of admin
+func (s Service) RegisterTenantUser(ctx context.Context, tenantID string, authUser *model.AuthUser) error {
+	if tenantID == "" {
+		return fmt.Errorf("service: registration failed - %w", repository.NewError(repository.ErrValidation, "empty tenantID"))
+	}
+	return s.register(ctx, tenantID, authUser)
+}
+
+func (s Service) register(ctx context.Context, tenantID string, authUser *model.AuthUser) error {
+	if authUser.Email == "" {
+		return fmt.Errorf("service: registration failed - %w", repository.NewError(repository.ErrValidation, "empty email"))
+	}
+	if err := s.CheckTenant(ctx, tenantID); err != nil {
+		return fmt.Errorf("service: registration failed - %w", err)
+	}
 	hPassword, err := hashPassword(authUser.Password)
 	if err != nil {
 		return err
 	}
 	authUser.Password = hPassword
-	err = s.rps.SaveAuthUser(ctx, authUser)
+	authUser.TenantID = tenantID
+	err = s.rps.SaveAuthUser(tenant.WithID(ctx, tenantID), authUser)
 	if err != nil {
 		return fmt.Errorf("service: registration failed - %w", err)
 	}
@@ -59,45 +90,75 @@ func (s Service) RefreshToken(ctx context.Context, refreshTokenString string) (s
 	}
 	refreshToken, err := jwt.Parse(refreshTokenString, keyFunc)
 	if err != nil {
-		return "", "", fmt.Errorf("service: can't parse refresh token - %w", err)
+		return "", "", fmt.Errorf("service: can't parse refresh token: %v - %w", err, ErrUnauthorized)
 	}
 	if !refreshToken.Valid {
-		return "", "", fmt.Errorf("service: expired refresh token")
+		return "", "", fmt.Errorf("service: expired refresh token - %w", ErrUnauthorized)
 	}
 	claims := refreshToken.Claims.(jwt.MapClaims)
 	userUUID := claims["jti"]
-	if userUUID == "" {
-		return "", "", fmt.Errorf("service: error while parsing claims")
+	if userUUID == nil || userUUID == "" {
+		return "", "", fmt.Errorf("service: refresh token has no user - %w", ErrUnauthorized)
 	}
-	authUser, err := s.rps.GetAuthUserByID(ctx, userUUID.(string))
-	if err != nil {
+	tenantID, _ := claims["tenantID"].(string)
+	if tenantID == "" {
+		tenantID = tenant.DefaultID
+	}
+	if err := s.CheckTenant(ctx, tenantID); err != nil {
 		return "", "", fmt.Errorf("service: token refresh failed - %w", err)
 	}
-	if refreshTokenString != authUser.RefreshToken {
-		return "", "", fmt.Errorf("service: invalid refresh token")
+	ctx = tenant.WithID(ctx, tenantID)
+	var accessTokenString, newRefreshTokenString string
+	err = s.rps.WithinTransaction(ctx, func(ctx context.Context, rps repository.Repository) error {
+		userID, _ := userUUID.(string)
+		authUser, err := rps.GetAuthUserByID(ctx, userID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("service: token refresh failed, user %s not found - %w", userID, ErrUnauthorized)
+		}
+		if err != nil {
+			return fmt.Errorf("service: token refresh failed - %w", err)
+		}
+		if refreshTokenString != authUser.RefreshToken {
+			return fmt.Errorf("service: refresh token was replaced - %w", ErrUnauthorized)
+		}
+		accessTokenString, newRefreshTokenString, err = createTokenPair(rps, ctx, authUser)
+		return err
+	})
+	if err != nil {
+		return "", "", err
 	}
-	return createTokenPair(s.rps, ctx, authUser)
+	return accessTokenString, newRefreshTokenString, nil
 }
 
-// Authentication method check user password for validity and if it's correct return access and refresh tokens
+// Authentication method check user password for validity and if it's correct return access and refresh tokens.
+// Email is unique across tenants, so user is found in all of them and tokens are issued for tenant stored with user
 func (s Service) Authentication(ctx context.Context, email, password string) (string, string, error) {
 	hashPassword, err := hashPassword(password)
 	if err != nil {
 		return "", "", err
 	}
-	authForm, err := s.rps.GetAuthUser(ctx, email)
+	// unknown email and wrong password fail the same way, so emails of
+	// users can't be probed
+	authForm, err := s.rps.GetAuthUser(tenant.AllTenants(ctx), email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", "", fmt.Errorf("service: authentication failed - %w", ErrUnauthorized)
+	}
 	if err != nil {
 		return "", "", fmt.Errorf("service: authentication failed - %w", err)
 	}
 	if authForm.Password != hashPassword {
-		return "", "", fmt.Errorf("service: invalid password")
+		return "", "", fmt.Errorf("service: invalid password - %w", ErrUnauthorized)
+	}
+	if err := s.CheckTenant(ctx, authForm.TenantID); err != nil {
+		return "", "", fmt.Errorf("service: authentication failed - %w", err)
 	}
-	return createTokenPair(s.rps, ctx, authForm)
+	return createTokenPair(s.rps, tenant.WithID(ctx, authForm.TenantID), authForm)
 }
 
-// UpdateAuthUser method update user instance in repository
+// UpdateAuthUser method update user instance in repository. Email is unique
+// across tenants, so user is updated in tenant which owns it
 func (s Service) UpdateAuthUser(ctx context.Context, email string, refreshToken string) error {
-	return s.rps.UpdateAuthUser(ctx, email, refreshToken)
+	return s.rps.UpdateAuthUser(tenant.AllTenants(ctx), email, refreshToken)
 }
 
 func createTokenPair(rps repository.Repository, ctx context.Context, authUser *model.AuthUser) (string, string, error) {
@@ -107,6 +168,7 @@ func createTokenPair(rps repository.Repository, ctx context.Context, authUser *m
 	atClaims := &CustomClaims{
 		userName: authUser.UserName,
 		email:    authUser.Email,
+		TenantID: authUser.TenantID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTimeAT.Unix(),
 		},
@@ -120,6 +182,7 @@ func createTokenPair(rps repository.Repository, ctx context.Context, authUser *m
 	rtClaims := &CustomClaims{
 		userName: authUser.UserName,
 		email:    authUser.Email,
+		TenantID: authUser.TenantID,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTimeRT.Unix(),
 			Id:        authUser.UserUUID,
@@ -140,7 +203,7 @@ func createTokenPair(rps repository.Repository, ctx context.Context, authUser *m
 
 func hashPassword(password string) (string, error) {
 	if password == "" {
-		return "", fmt.Errorf("service: zero password value")
+		return "", repository.NewError(repository.ErrValidation, "zero password value")
 	}
 	h := sha256.New()
 	h.Write([]byte(password))
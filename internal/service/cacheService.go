@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/cache"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+)
+
+// CacheStats method returns cache size and stream consumer position
+func (s Service) CacheStats() (*cache.Stats, error) {
+	stats, err := s.orderCache.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("service: can't get cache stats - %w", err)
+	}
+	return stats, nil
+}
+
+// InvalidateCachedOrder method drops order of tenant from cache
+func (s Service) InvalidateCachedOrder(tenantID, orderID string) error {
+	if orderID == "" {
+		return fmt.Errorf("service: can't invalidate cached order - %w", repository.NewError(repository.ErrValidation, "empty orderID"))
+	}
+	if err := s.orderCache.Invalidate(tenantID, orderID); err != nil {
+		return fmt.Errorf("service: can't invalidate cached order - %w", err)
+	}
+	return nil
+}
+
+// FlushCache method drops all cached orders
+func (s Service) FlushCache() {
+	s.orderCache.Flush()
+}
+
+// RebuildCache method drops all cached orders and loads them again from
+// repository
+func (s Service) RebuildCache(ctx context.Context, limit, batchSize int) (int, error) {
+	s.orderCache.Flush()
+	return s.WarmUpCache(ctx, limit, batchSize)
+}
+
+// ReplayCache method rebuilds cache from stream history starting at message
+// fromID, empty fromID replays whole history
+func (s Service) ReplayCache(fromID string) (int, error) {
+	applied, err := s.orderCache.Replay(fromID)
+	if err != nil {
+		return applied, fmt.Errorf("service: can't replay cache - %w", err)
+	}
+	return applied, nil
+}
+
+// StreamInfos method returns size of every tenant stream
+func (s Service) StreamInfos() ([]cache.StreamInfo, error) {
+	infos, err := s.orderCache.StreamInfos()
+	if err != nil {
+		return nil, fmt.Errorf("service: can't get stream stats - %w", err)
+	}
+	return infos, nil
+}
+
+// DeadLetters method returns up to limit dead letters of cache streams added
+// after afterID
+func (s Service) DeadLetters(afterID string, limit int) ([]cache.DeadLetter, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("service: can't get dead letters - %w", repository.NewError(repository.ErrValidation, "limit must be positive"))
+	}
+	letters, err := s.orderCache.DeadLetters(afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("service: can't get dead letters - %w", err)
+	}
+	return letters, nil
+}
+
+// ReplayDeadLetter method publishes dead letter to its tenant stream again
+func (s Service) ReplayDeadLetter(id string) error {
+	found, err := s.orderCache.ReplayDeadLetter(id)
+	if err != nil {
+		return fmt.Errorf("service: can't replay dead letter - %w", err)
+	}
+	if !found {
+		return fmt.Errorf("service: can't replay dead letter - %w", repository.NewError(repository.ErrNotFound, "dead letter %s not found", id))
+	}
+	return nil
+}
+
+// DiscardDeadLetter method removes dead letter without applying it
+func (s Service) DiscardDeadLetter(id string) error {
+	found, err := s.orderCache.DiscardDeadLetter(id)
+	if err != nil {
+		return fmt.Errorf("service: can't discard dead letter - %w", err)
+	}
+	if !found {
+		return fmt.Errorf("service: can't discard dead letter - %w", repository.NewError(repository.ErrNotFound, "dead letter %s not found", id))
+	}
+	return nil
+}
@@ -2,50 +2,127 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"time"
 
 	"github.com/google/uuid"
 )
 
-// Save function method generate order uuid and after that save instance in cache and repository
+// sharedLoadTimeout is how long repository lookup shared by concurrent
+// misses of the same order may take
+const sharedLoadTimeout = 5 * time.Second
+
+// Save function method generate order uuid and after that save instance in repository and cache. Cache
+// is changed after repository, so cache event is never published for order which wasn't saved
 func (s Service) Save(ctx context.Context, order *model.Order) (string, error) {
+	if err := validateOrder(order); err != nil {
+		return "", fmt.Errorf("service: can't create order - %w", err)
+	}
 	order.OrderID = uuid.New().String()
-	err := s.orderCache.Save(order)
+	order.TenantID = tenant.IDOrDefault(ctx)
+	order.DeliveredAt = 0
+	if order.IsDelivered {
+		order.DeliveredAt = time.Now().Unix()
+	}
+	order.UpdatedAt = time.Now().UnixMicro()
+	err := s.rps.Save(ctx, order)
 	if err != nil {
 		return "", fmt.Errorf("service: can't create order - %w", err)
 	}
-	err = s.rps.Save(ctx, order)
+	err = s.orderCache.Save(order)
 	if err != nil {
 		return "", fmt.Errorf("service: can't create order - %w", err)
 	}
 	return order.OrderID, nil
 }
 
-// Get method look through cache for order and if order wasn't found, method get it from repository and add it in cache
+// Get method look through cache for order and if order wasn't found, method get it from repository and add it in cache.
+// Order which isn't in live store is looked up in archive. Concurrent misses of the same order share one
+// repository lookup and orders which weren't found are remembered for a short time. Shared lookup doesn't
+// belong to any request, so request which gives up doesn't fail the others
 func (s Service) Get(ctx context.Context, orderID string) (*model.Order, error) {
-	order, found := s.orderCache.Get(orderID) // add second param as ok
-	if !found {
-		order, err := s.rps.Get(ctx, orderID)
-		if err != nil {
-			return nil, fmt.Errorf("service: can't get order - %w", err)
+	if orderID == "" {
+		return nil, fmt.Errorf("service: can't get order - %w", repository.NewError(repository.ErrValidation, "empty orderID"))
+	}
+	tenantID := tenant.IDOrDefault(ctx)
+	order, found := s.orderCache.Get(tenantID, orderID) // add second param as ok
+	if found {
+		s.readMetrics.read(readCacheHit)
+		return order, nil
+	}
+	if s.orderCache.Missing(tenantID, orderID) {
+		s.readMetrics.read(readNegativeHit)
+		return nil, fmt.Errorf("service: can't get order - %w", repository.NewError(repository.ErrNotFound, "order %s not found", orderID))
+	}
+	// requests which must read from primary share lookup only with each
+	// other, so requests reading from replicas don't wait for primary
+	key := tenantID + "/" + orderID
+	primary := repository.PinnedToPrimary(ctx)
+	if primary {
+		key += "/primary"
+	}
+	loaded := false
+	result := s.reads.DoChan(key, func() (interface{}, error) {
+		loaded = true
+		loadCtx, cancel := context.WithTimeout(tenant.WithID(context.Background(), tenantID), sharedLoadTimeout)
+		defer cancel()
+		if primary {
+			loadCtx = repository.WithPrimary(loadCtx)
 		}
-		err = s.orderCache.Save(order)
-		if err != nil {
-			return nil, fmt.Errorf("service: can't get order - %w", err)
+		return s.load(loadCtx, tenantID, orderID)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("service: can't get order - %w", ctx.Err())
+	case r := <-result:
+		if loaded {
+			s.readMetrics.read(readDatabase)
+		} else {
+			s.readMetrics.read(readCoalesced)
 		}
-		return order, nil
+		if r.Err != nil {
+			return nil, fmt.Errorf("service: can't get order - %w", r.Err)
+		}
+		return r.Val.(*model.Order), nil
+	}
+}
+
+// load reads order from repository, falling back to archive, and preloads
+// live order into cache. Read order isn't published as change, so it can't
+// overwrite newer state of order. Order missing in both is marked missing
+// in cache
+func (s Service) load(ctx context.Context, tenantID, orderID string) (*model.Order, error) {
+	order, err := s.rps.Get(ctx, orderID)
+	if errors.Is(err, repository.ErrNotFound) {
+		order, err = s.rps.GetArchivedOrder(ctx, orderID)
+		if errors.Is(err, repository.ErrNotFound) {
+			s.orderCache.MarkMissing(tenantID, orderID)
+		}
+		return order, err
 	}
+	if err != nil {
+		return nil, err
+	}
+	s.orderCache.Preload(order)
 	return order, nil
 }
 
-// Delete method delete order from repository and cache
+// Delete method delete order from repository and cache. Cache is changed
+// after repository, so order read while it is deleted can't be cached after
+// its tombstone
 func (s Service) Delete(ctx context.Context, orderID string) error {
-	err := s.orderCache.Delete(orderID)
+	if orderID == "" {
+		return fmt.Errorf("service: can't delete order - %w", repository.NewError(repository.ErrValidation, "empty orderID"))
+	}
+	err := s.rps.Delete(ctx, orderID)
 	if err != nil {
 		return fmt.Errorf("service: can't delete order - %w", err)
 	}
-	err = s.rps.Delete(ctx, orderID)
+	err = s.orderCache.Delete(tenant.IDOrDefault(ctx), orderID)
 	if err != nil {
 		return fmt.Errorf("service: can't delete order - %w", err)
 	}
@@ -54,13 +131,63 @@ func (s Service) Delete(ctx context.Context, orderID string) error {
 
 // Update method update order instance in repository and cache
 func (s Service) Update(ctx context.Context, order *model.Order) error {
-	err := s.orderCache.Update(order)
+	if order.OrderID == "" {
+		return fmt.Errorf("service: can't update order - %w", repository.NewError(repository.ErrValidation, "empty orderID"))
+	}
+	if err := validateOrder(order); err != nil {
+		return fmt.Errorf("service: can't update order - %w", err)
+	}
+	order.TenantID = tenant.IDOrDefault(ctx)
+	err := s.rps.WithinTransaction(ctx, func(ctx context.Context, rps repository.Repository) error {
+		stored, err := rps.Get(ctx, order.OrderID)
+		if err != nil {
+			return err
+		}
+		order.DeliveredAt = deliveryTime(stored, order)
+		order.UpdatedAt = time.Now().UnixMicro()
+		return rps.Update(ctx, order)
+	})
 	if err != nil {
 		return fmt.Errorf("service: can't update order - %w", err)
 	}
-	err = s.rps.Update(ctx, order)
+	err = s.orderCache.Update(order)
 	if err != nil {
 		return fmt.Errorf("service: can't update order - %w", err)
 	}
 	return nil
 }
+
+// GetArchived method returns order from archive
+func (s Service) GetArchived(ctx context.Context, orderID string) (*model.Order, error) {
+	if orderID == "" {
+		return nil, fmt.Errorf("service: can't get archived order - %w", repository.NewError(repository.ErrValidation, "empty orderID"))
+	}
+	order, err := s.rps.GetArchivedOrder(ctx, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("service: can't get archived order - %w", err)
+	}
+	return order, nil
+}
+
+// deliveryTime returns DeliveredAt of updated order. Time of delivery is
+// kept while order stays delivered
+func deliveryTime(stored, updated *model.Order) int64 {
+	switch {
+	case !updated.IsDelivered:
+		return 0
+	case stored.IsDelivered && stored.DeliveredAt != 0:
+		return stored.DeliveredAt
+	default:
+		return time.Now().Unix()
+	}
+}
+
+func validateOrder(order *model.Order) error {
+	if order.OrderName == "" {
+		return repository.NewError(repository.ErrValidation, "empty order name")
+	}
+	if order.OrderCost < 0 {
+		return repository.NewError(repository.ErrValidation, "negative order cost")
+	}
+	return nil
+}
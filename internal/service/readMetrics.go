@@ -0,0 +1,41 @@
+package service
+
+import (
+	"github.com/EgorBessonov/CRUDServer/internal/metrics"
+)
+
+// results of order read
+const (
+	readCacheHit    = "cache_hit"
+	readNegativeHit = "negative_hit"
+	readCoalesced   = "coalesced"
+	readDatabase    = "database"
+)
+
+// ReadMetrics type counts order reads by how they were served. Reads
+// served by negative cache or coalesced with concurrent read are database
+// calls saved
+type ReadMetrics struct {
+	reads *metrics.CounterVec
+	saved *metrics.CounterVec
+}
+
+// NewReadMetrics registers order read metric families in reg
+func NewReadMetrics(reg *metrics.Registry) *ReadMetrics {
+	return &ReadMetrics{
+		reads: reg.NewCounterVec("crudserver_order_reads_total",
+			"Order reads by result.", "result"),
+		saved: reg.NewCounterVec("crudserver_order_db_calls_saved_total",
+			"Repository calls avoided on cache miss.", "reason"),
+	}
+}
+
+func (m *ReadMetrics) read(result string) {
+	if m == nil {
+		return
+	}
+	m.reads.With(result).Inc()
+	if result == readNegativeHit || result == readCoalesced {
+		m.saved.With(result).Inc()
+	}
+}
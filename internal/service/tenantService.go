@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/model"
+	"github.com/EgorBessonov/CRUDServer/internal/repository"
+)
+
+// ErrTenantDisabled is returned when request is made on behalf of disabled tenant
+var ErrTenantDisabled = errors.New("tenant disabled")
+
+// CreateTenant method validates tenant and saves it in repository
+func (s Service) CreateTenant(ctx context.Context, t *model.Tenant) error {
+	if t.TenantID == "" {
+		return fmt.Errorf("service: can't create tenant - %w", repository.NewError(repository.ErrValidation, "empty tenantID"))
+	}
+	if err := s.rps.SaveTenant(ctx, t); err != nil {
+		return fmt.Errorf("service: can't create tenant - %w", err)
+	}
+	return nil
+}
+
+// DisableTenant method marks tenant as disabled, so its users can't
+// authenticate and its tokens are rejected
+func (s Service) DisableTenant(ctx context.Context, tenantID string) error {
+	if tenantID == "" {
+		return fmt.Errorf("service: can't disable tenant - %w", repository.NewError(repository.ErrValidation, "empty tenantID"))
+	}
+	err := s.rps.WithinTransaction(ctx, func(ctx context.Context, rps repository.Repository) error {
+		t, err := rps.GetTenant(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		t.Disabled = true
+		return rps.UpdateTenant(ctx, t)
+	})
+	if err != nil {
+		return fmt.Errorf("service: can't disable tenant - %w", err)
+	}
+	return nil
+}
+
+// CheckTenant method returns error if tenant doesn't exist or is disabled
+func (s Service) CheckTenant(ctx context.Context, tenantID string) error {
+	t, err := s.rps.GetTenant(ctx, tenantID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return repository.NewError(repository.ErrValidation, "unknown tenant %s", tenantID)
+	}
+	if err != nil {
+		return err
+	}
+	if t.Disabled {
+		return ErrTenantDisabled
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WarmUpCache method loads up to limit orders of all tenants from
+// repository into cache in pages of batchSize and then marks cache ready.
+// Most recently updated orders are loaded first, so limited warm-up keeps
+// the hottest orders. Zero limit loads all orders
+func (s Service) WarmUpCache(ctx context.Context, limit, batchSize int) (int, error) {
+	start := time.Now()
+	loaded := 0
+	var beforeUpdatedAt int64
+	beforeID := ""
+	for limit <= 0 || loaded < limit {
+		size := batchSize
+		if limit > 0 && limit-loaded < size {
+			size = limit - loaded
+		}
+		orders, err := s.rps.GetRecentOrders(ctx, beforeUpdatedAt, beforeID, size)
+		if err != nil {
+			return loaded, fmt.Errorf("service: can't warm up cache - %w", err)
+		}
+		for _, order := range orders {
+			s.orderCache.Preload(order)
+			beforeUpdatedAt, beforeID = order.UpdatedAt, order.OrderID
+		}
+		loaded += len(orders)
+		log.WithFields(log.Fields{
+			"loaded": loaded,
+			"limit":  limit,
+		}).Info("service: cache warm-up progress")
+		if len(orders) < size {
+			break
+		}
+	}
+	s.orderCache.MarkReady()
+	log.WithFields(log.Fields{
+		"loaded":   loaded,
+		"duration": time.Since(start),
+	}).Info("service: cache warmed up")
+	return loaded, nil
+}
+
+// Ready method reports whether instance is ready to serve traffic
+func (s Service) Ready() bool {
+	return s.orderCache.Ready()
+}
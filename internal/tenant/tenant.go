@@ -0,0 +1,43 @@
+// Package tenant replies passing tenant identity through request context
+package tenant
+
+import "context"
+
+// DefaultID is tenant which owns data created without explicit tenant
+const DefaultID = "default"
+
+type contextKey struct{}
+
+type allTenantsKey struct{}
+
+// WithID returns context which scopes repository and cache calls to tenant
+func WithID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+// FromContext returns tenant ID stored in ctx
+func FromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(contextKey{}).(string)
+	return tenantID, ok
+}
+
+// AllTenants returns context which lets repository calls see data of all
+// tenants. It is used by admin endpoints and system jobs only, repository
+// refuses calls with context which carries neither tenant nor this mark
+func AllTenants(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allTenantsKey{}, true)
+}
+
+// IsAllTenants reports whether ctx is marked by AllTenants
+func IsAllTenants(ctx context.Context) bool {
+	all, _ := ctx.Value(allTenantsKey{}).(bool)
+	return all
+}
+
+// IDOrDefault returns tenant ID stored in ctx or DefaultID
+func IDOrDefault(ctx context.Context) string {
+	if tenantID, ok := FromContext(ctx); ok {
+		return tenantID
+	}
+	return DefaultID
+}
@@ -6,8 +6,16 @@ import (
 	"github.com/EgorBessonov/CRUDServer/internal/cache"
 	"github.com/EgorBessonov/CRUDServer/internal/config"
 	"github.com/EgorBessonov/CRUDServer/internal/handler"
+	"github.com/EgorBessonov/CRUDServer/internal/metrics"
 	"github.com/EgorBessonov/CRUDServer/internal/repository"
+	"github.com/EgorBessonov/CRUDServer/internal/retry"
 	"github.com/EgorBessonov/CRUDServer/internal/service"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	_ "github.com/EgorBessonov/CRUDServer/docs"
 	"github.com/caarlos0/env"
@@ -21,6 +29,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+const (
+	shutdownTimeout = 10
+)
+
 // @title CRUDServer
 // @version 1.0
 //description This is a simple crud server for mongo & postgres databases with jwt authentication
@@ -36,30 +48,103 @@ func main() {
 	if err := env.Parse(&cfg); err != nil {
 		fmt.Println(err)
 	}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigration(cfg, os.Args[2:]); err != nil {
+				log.Fatalf("migration failed - %v", err)
+			}
+			return
+		case "backup":
+			if err := runBackup(cfg, os.Args[2:]); err != nil {
+				log.Fatalf("backup failed - %v", err)
+			}
+			return
+		case "restore":
+			if err := runRestore(cfg, os.Args[2:]); err != nil {
+				log.Fatalf("restore failed - %v", err)
+			}
+			return
+		case "replay":
+			if err := runReplay(cfg, os.Args[2:]); err != nil {
+				log.Fatalf("replay failed - %v", err)
+			}
+			return
+		}
+	}
 	e := echo.New()
+	e.HTTPErrorHandler = handler.ErrorHandler(e)
+	e.Use(handler.ReadAfterWrite)
 
-	repo := dbConnection(cfg)
-	redisClient := redisConnection(cfg)
-	defer func() {
-		err := redisClient.Close()
+	// background jobs work with data of all tenants
+	bgCtx, stopBackground := context.WithCancel(tenant.AllTenants(context.Background()))
+	defer stopBackground()
+	repoMetrics := repository.NewRepositoryMetrics(metrics.Default)
+	repo, health, err := dbConnection(bgCtx, cfg, cfg.CurrentDB)
+	if err != nil {
+		log.Fatalf("can't connect to %s database - %v", cfg.CurrentDB, err)
+	}
+	primary := repo
+	repo = instrument(cfg, repo, cfg.CurrentDB, repoMetrics)
+	if cfg.DualWriteDB != "" {
+		secondary, _, err := dbConnection(bgCtx, cfg, cfg.DualWriteDB)
 		if err != nil {
-			log.Errorf("error while closing redis connection - %e", err)
+			log.Fatalf("can't connect to %s database - %v", cfg.DualWriteDB, err)
 		}
-	}()
-	c := cache.NewCache(redisClient.Context(), cfg, redisClient)
-	s := service.NewService(repo, c)
+		repo = repository.NewDualWriteRepository(repo, instrument(cfg, secondary, cfg.DualWriteDB, repoMetrics))
+	}
+	var redisClient *redis.Client
+	if cache.NeedsRedis(cfg) {
+		redisClient, err = redisConnection(bgCtx, cfg)
+		if err != nil {
+			log.Warnf("can't connect to redis, cache starts degraded - %v", err)
+		}
+		defer func() {
+			err := redisClient.Close()
+			if err != nil {
+				log.Errorf("error while closing redis connection - %e", err)
+			}
+		}()
+	}
+	c, err := cache.NewCache(bgCtx, cfg, redisClient, cache.NewMetrics(metrics.Default))
+	if err != nil {
+		log.Fatalf("can't create cache - %v", err)
+	}
+	if err := listenDatabase(bgCtx, cfg, c, primary); err != nil {
+		log.Fatalf("can't start cache invalidation - %v", err)
+	}
+	s := service.NewService(repo, c, service.NewReadMetrics(metrics.Default))
+	s.RunArchiver(bgCtx, cfg.ArchiveInterval, time.Duration(cfg.ArchiveAfterDays)*24*time.Hour, cfg.ArchiveBatchSize)
+	warmUpCache(bgCtx, cfg, s, c)
 	h := handler.NewHandler(s, &cfg)
+	h.WatchDependency(health)
 	g := e.Group("/orders")
 	config := middleware.JWTConfig{
 		Claims:     &service.CustomClaims{},
 		SigningKey: []byte(cfg.SecretKey),
 	}
-	g.Use(middleware.JWTWithConfig(config))
+	g.Use(middleware.JWTWithConfig(config), h.Tenant)
 
 	g.POST("/saveOrder", h.SaveOrder)
 	g.PUT("/updateOrder", h.UpdateOrderByID)
 	g.DELETE("/deleteOrder", h.DeleteOrderByID)
 	g.GET("/getOrder", h.GetOrderByID)
+	g.GET("/getArchivedOrder", h.GetArchivedOrder)
+
+	admin := e.Group("/admin")
+	admin.Use(middleware.KeyAuth(handler.AdminKeyValidator(cfg.AdminKey)), handler.AllTenants)
+	admin.POST("/tenants", h.CreateTenant)
+	admin.PUT("/tenants/disable", h.DisableTenant)
+	admin.POST("/tenants/users", h.RegisterTenantUser)
+	admin.GET("/cache", h.CacheStats)
+	admin.DELETE("/cache/orders", h.InvalidateCachedOrder)
+	admin.POST("/cache/flush", h.FlushCache)
+	admin.POST("/cache/rebuild", h.RebuildCache)
+	admin.POST("/cache/replay", h.ReplayCache)
+	admin.GET("/streams", h.StreamStats)
+	admin.GET("/deadletters", h.DeadLetters)
+	admin.POST("/deadletters/replay", h.ReplayDeadLetter)
+	admin.DELETE("/deadletters", h.DiscardDeadLetter)
 
 	e.POST("/registration", h.Registration)
 	e.POST("/authentication", h.Authentication)
@@ -69,61 +154,224 @@ func main() {
 	e.GET("/images/downloadImage", h.DownloadImage)
 	e.POST("/images/uploadImage", h.UploadImage)
 
+	e.GET("/metrics", handler.Metrics(metrics.Default))
+	e.GET("/ready", h.Ready)
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
-	e.Logger.Fatal(e.Start(":8081"))
+	go func() {
+		if err := e.Start(":8081"); err != nil && err != http.ErrServerClosed {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	<-quit
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		log.Errorf("error while shutting down server - %e", err)
+	}
+	if err := repo.CloseDBConnection(); err != nil {
+		log.Errorf("error while closing repository - %e", err)
+	}
 }
 
-func dbConnection(cfg configs.Config) repository.Repository {
-	switch cfg.CurrentDB {
+// instrument wraps repository of backend into metrics decorator and
+// exposes postgres pool statistics
+func instrument(cfg configs.Config, rps repository.Repository, backend string, m *repository.RepositoryMetrics) repository.Repository {
+	if pg, ok := rps.(repository.PostgresRepository); ok {
+		pools := map[string]*pgxpool.Pool{"primary": pg.DBconn}
+		for idx, pool := range pg.Replicas.Pools() {
+			pools[fmt.Sprintf("replica-%d", idx)] = pool
+		}
+		if err := repository.RegisterPoolMetrics(metrics.Default, pools); err != nil {
+			log.Warnf("pool statistics of %s database aren't exposed - %v", backend, err)
+		}
+	}
+	return repository.NewInstrumentedRepository(rps, backend, m, cfg.SlowQueryThreshold)
+}
+
+// warmUpCache starts loading orders into cache in background, instance
+// reports readiness when it is done. Failed warm-up only leaves cache cold,
+// so instance becomes ready anyway
+func warmUpCache(ctx context.Context, cfg configs.Config, s *service.Service, c *cache.OrderCache) {
+	if !cfg.CacheWarmup {
+		c.MarkReady()
+		return
+	}
+	limit, batchSize := cache.WarmupLimits(cfg)
+	go func() {
+		if _, err := s.WarmUpCache(ctx, limit, batchSize); err != nil {
+			log.Errorf("cache warm-up failed - %v", err)
+			c.MarkReady()
+		}
+	}()
+}
+
+// listenDatabase starts cache invalidation sources which depend on current
+// database
+func listenDatabase(ctx context.Context, cfg configs.Config, c *cache.OrderCache, rps repository.Repository) error {
+	for _, source := range cfg.CacheSources {
+		switch source {
+		case "stream":
+		case "postgres":
+			pg, ok := rps.(repository.PostgresRepository)
+			if !ok {
+				return fmt.Errorf("postgres cache source requires postgres database")
+			}
+			c.ListenPostgres(ctx, cfg, pg.DBconn)
+		case "mongo":
+			mg, ok := rps.(repository.MongoRepository)
+			if !ok {
+				return fmt.Errorf("mongo cache source requires mongo database")
+			}
+			c.ListenMongo(ctx, cfg, mg.OrdersCollection())
+		default:
+			return fmt.Errorf("unknown cache source %q", source)
+		}
+	}
+	return nil
+}
+
+func connectPolicy(cfg configs.Config) retry.Policy {
+	return retry.Policy{
+		Attempts:       cfg.ConnectAttempts,
+		InitialBackoff: cfg.ConnectBackoff,
+		MaxBackoff:     cfg.ConnectMaxBackoff,
+	}
+}
+
+// dbConnection connects to database db and migrates it. Health of database
+// server is watched until ctx is done and returned, embedded databases have
+// none
+func dbConnection(ctx context.Context, cfg configs.Config, db string) (repository.Repository, *retry.Health, error) {
+	switch db {
 	case "mongo":
-		client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.MongodbURL))
+		client, err := mongo.NewClient(options.Client().ApplyURI(cfg.MongodbURL))
 		if err != nil {
-			log.WithFields(log.Fields{
-				"status": "connection to mongo database failed.",
-				"err":    err,
-			}).Info("mongo repository info")
-		} else {
-			log.WithFields(log.Fields{
-				"status": "successfully connected to mongo database.",
-			}).Info("mongo repository info.")
+			return nil, nil, fmt.Errorf("invalid mongo config - %w", err)
 		}
-		return repository.MongoRepository{DBconn: client}
+		if err := client.Connect(ctx); err != nil {
+			return nil, nil, fmt.Errorf("can't connect to mongo database - %w", err)
+		}
+		err = retry.Do(ctx, "mongo connection", connectPolicy(cfg), func(ctx context.Context) error {
+			pingCtx, cancel := context.WithTimeout(ctx, cfg.ConnectMaxBackoff)
+			defer cancel()
+			return client.Ping(pingCtx, nil)
+		})
+		if err != nil {
+			_ = client.Disconnect(ctx)
+			return nil, nil, err
+		}
+		log.WithFields(log.Fields{
+			"status": "successfully connected to mongo database.",
+		}).Info("mongo repository info.")
+		rps := repository.MongoRepository{DBconn: client}
+		if err := rps.CheckTransactions(ctx); err != nil {
+			log.Warnf("mongo repository runs without transactions - %v", err)
+			rps.WithoutTransactions = true
+		}
+		if err := rps.Migrate(ctx); err != nil {
+			_ = client.Disconnect(ctx)
+			return nil, nil, fmt.Errorf("mongo migrations failed - %w", err)
+		}
+		health := retry.Watch(ctx, "mongo", cfg.HealthCheckInterval, func(ctx context.Context) error {
+			return client.Ping(ctx, nil)
+		})
+		return rps, health, nil
 	case "postgres":
-		conn, err := pgxpool.Connect(context.Background(), cfg.PostgresdbURL)
+		var conn *pgxpool.Pool
+		err := retry.Do(ctx, "postgres connection", connectPolicy(cfg), func(ctx context.Context) error {
+			var err error
+			conn, err = pgxpool.Connect(ctx, cfg.PostgresdbURL)
+			return err
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		log.WithFields(log.Fields{
+			"status": "successfully connected to postgres database.",
+		}).Info("postgres repository info.")
+		rps := repository.PostgresRepository{DBconn: conn, Replicas: replicaConnection(cfg)}
+		if err := rps.Migrate(ctx); err != nil {
+			_ = rps.CloseDBConnection()
+			return nil, nil, fmt.Errorf("postgres migrations failed - %w", err)
+		}
+		return rps, retry.Watch(ctx, "postgres", cfg.HealthCheckInterval, conn.Ping), nil
+	case "sqlite":
+		rps, err := repository.NewSqliteRepository(ctx, cfg.SqlitedbURL)
+		if err != nil {
+			return nil, nil, fmt.Errorf("can't open sqlite database - %w", err)
+		}
+		log.WithFields(log.Fields{
+			"status": "successfully connected to sqlite database.",
+		}).Info("sqlite repository info.")
+		return rps, nil, nil
+	case "memory":
+		rps, err := repository.NewMemoryRepository(cfg.SnapshotPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("memory repository initialization failed - %w", err)
+		}
+		log.WithFields(log.Fields{
+			"status":   "memory repository initialized.",
+			"snapshot": cfg.SnapshotPath,
+		}).Info("memory repository info.")
+		return rps, nil, nil
+	}
+	return nil, nil, fmt.Errorf("invalid database %q", db)
+}
+
+// replicaConnection creates replica pools lazily, so replica which is down
+// at startup is skipped by health checks and used once it comes back
+func replicaConnection(cfg configs.Config) *repository.ReplicaSet {
+	if len(cfg.PostgresReplicaURLs) == 0 {
+		return nil
+	}
+	pools := make([]*pgxpool.Pool, 0, len(cfg.PostgresReplicaURLs))
+	for _, url := range cfg.PostgresReplicaURLs {
+		poolConfig, err := pgxpool.ParseConfig(url)
 		if err != nil {
 			log.WithFields(log.Fields{
-				"status": "connection to postgres database failed.",
+				"status": "invalid postgres replica config.",
 				"err":    err,
 			}).Info("postgres repository info.")
-		} else {
+			continue
+		}
+		poolConfig.LazyConnect = true
+		pool, err := pgxpool.ConnectConfig(context.Background(), poolConfig)
+		if err != nil {
 			log.WithFields(log.Fields{
-				"status": "successfully connected to postgres database.",
+				"status": "connection to postgres replica failed.",
+				"err":    err,
 			}).Info("postgres repository info.")
+			continue
 		}
-		return repository.PostgresRepository{DBconn: conn}
+		pools = append(pools, pool)
 	}
 	log.WithFields(log.Fields{
-		"status": "database connection failed.",
-		"err":    "invalid config",
-	}).Info("repository info")
-	return nil
+		"status":   "connected to postgres replicas.",
+		"replicas": len(pools),
+	}).Info("postgres repository info.")
+	return repository.NewReplicaSet(pools, cfg.ReplicaCheckInterval)
 }
 
-func redisConnection(cfg configs.Config) *redis.Client {
+// redisConnection returns redis client even if redis can't be reached, the
+// client reconnects on its own and cache works degraded until then. Health
+// of redis is watched by cache
+func redisConnection(ctx context.Context, cfg configs.Config) (*redis.Client, error) {
 	redisClient := redis.NewClient(&redis.Options{
 		Addr:     cfg.RedisURL,
 		Password: "",
 		DB:       0,
 	})
-	if _, err := redisClient.Ping().Result(); err != nil {
-		log.WithFields(log.Fields{
-			"status": "error while connection to redisdb",
-			"err":    err,
-		}).Info("redis repository info.")
-		return nil
+	err := retry.Do(ctx, "redis connection", connectPolicy(cfg), func(ctx context.Context) error {
+		return redisClient.Ping().Err()
+	})
+	if err != nil {
+		return redisClient, err
 	}
 	log.WithFields(log.Fields{
 		"status": "successfully connected to redisdb",
 	}).Info("redis repository info.")
-	return redisClient
+	return redisClient, nil
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/config"
+	"github.com/EgorBessonov/CRUDServer/internal/migrator"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBatchSize = 500
+)
+
+// runMigration copies all data from CurrentDB repository to repository
+// selected by -to flag and verifies the result
+func runMigration(cfg configs.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	to := flags.String("to", "", "target database: postgres, mongo, sqlite or memory")
+	batchSize := flags.Int("batch", defaultBatchSize, "entities copied per batch")
+	checkpoint := flags.String("checkpoint", "migration.checkpoint.json", "checkpoint file, empty disables resuming")
+	verifyOnly := flags.Bool("verify-only", false, "only compare counts and checksums")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" || *to == cfg.CurrentDB {
+		return fmt.Errorf("target database must be set and differ from %q", cfg.CurrentDB)
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	ctx, cancel := context.WithCancel(tenant.AllTenants(context.Background()))
+	defer cancel()
+	src, _, err := dbConnection(ctx, cfg, cfg.CurrentDB)
+	if err != nil {
+		return fmt.Errorf("can't connect to source database - %w", err)
+	}
+	dst, _, err := dbConnection(ctx, cfg, *to)
+	if err != nil {
+		_ = src.CloseDBConnection()
+		return fmt.Errorf("can't connect to target database - %w", err)
+	}
+	defer func() {
+		if err := src.CloseDBConnection(); err != nil {
+			log.Errorf("error while closing source repository - %e", err)
+		}
+		if err := dst.CloseDBConnection(); err != nil {
+			log.Errorf("error while closing target repository - %e", err)
+		}
+	}()
+
+	m := migrator.NewMigrator(src, dst, *batchSize, *checkpoint)
+	if !*verifyOnly {
+		if err := m.Run(ctx); err != nil {
+			return err
+		}
+	}
+	report, err := m.Verify(ctx)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"sourceTenants":   report.SourceTenants.Count,
+		"targetTenants":   report.TargetTenants.Count,
+		"sourceOrders":    report.SourceOrders.Count,
+		"targetOrders":    report.TargetOrders.Count,
+		"sourceArchived":  report.SourceArchived.Count,
+		"targetArchived":  report.TargetArchived.Count,
+		"sourceAuthUsers": report.SourceAuthUsers.Count,
+		"targetAuthUsers": report.TargetAuthUsers.Count,
+		"match":           report.Match(),
+	}).Info("migration verification")
+	if !report.Match() {
+		return fmt.Errorf("target data differs from source: %+v", *report)
+	}
+	return nil
+}
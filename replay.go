@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/EgorBessonov/CRUDServer/internal/cache"
+	"github.com/EgorBessonov/CRUDServer/internal/config"
+	"github.com/EgorBessonov/CRUDServer/internal/replay"
+	"github.com/EgorBessonov/CRUDServer/internal/tenant"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// runReplay reads order history from cache streams and compares it with
+// repository selected by -to flag, drift is reported. History is written
+// into that repository only with -dry-run=false, and only if streams retain
+// every change of orders the repository holds
+func runReplay(cfg configs.Config, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := flags.String("from", "", "first stream message ID, empty reads streams from the beginning")
+	tenantID := flags.String("tenant", "", "tenant whose stream is read, empty reads streams of all tenants")
+	to := flags.String("to", "", "target database: postgres, mongo, sqlite or memory")
+	batchSize := flags.Int("batch", defaultBatchSize, "stream messages read per batch")
+	dryRun := flags.Bool("dry-run", true, "only compare history with target database, -dry-run=false rebuilds it")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("target database must be set with -to")
+	}
+	if *batchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	ctx, cancel := context.WithCancel(tenant.AllTenants(context.Background()))
+	defer cancel()
+	redisClient, err := redisConnection(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("can't connect to redis - %w", err)
+	}
+	defer func() {
+		if err := redisClient.Close(); err != nil {
+			log.Errorf("error while closing redis connection - %e", err)
+		}
+	}()
+	history, err := cache.ReadHistory(redisClient, cfg.StreamName, *tenantID, *from, *batchSize)
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"messages":  history.Messages,
+		"orders":    len(history.Entries),
+		"malformed": history.Malformed,
+		"stale":     history.Stale,
+	}).Info("stream history read")
+	rps, _, err := dbConnection(ctx, cfg, *to)
+	if err != nil {
+		return fmt.Errorf("can't connect to %s database - %w", *to, err)
+	}
+	defer func() {
+		if err := rps.CloseDBConnection(); err != nil {
+			log.Errorf("error while closing repository - %e", err)
+		}
+	}()
+
+	if !*dryRun {
+		oldest, err := cache.OldestMessages(redisClient, cfg.StreamName, *tenantID)
+		if err != nil {
+			return err
+		}
+		if err := replay.CheckRetention(ctx, oldest, rps, *tenantID, *batchSize); err != nil {
+			return fmt.Errorf("can't rebuild %s database - %w", *to, err)
+		}
+		result, err := replay.Rebuild(ctx, history, rps)
+		if err != nil {
+			return err
+		}
+		log.WithFields(log.Fields{
+			"target":  *to,
+			"saved":   result.Saved,
+			"deleted": result.Deleted,
+		}).Info("orders rebuilt from stream history")
+		return nil
+	}
+	report, err := replay.Diff(ctx, history, rps, *tenantID, *batchSize, *from == "")
+	if err != nil {
+		return err
+	}
+	for _, drift := range report.Drifts {
+		log.WithFields(log.Fields{
+			"kind":       drift.Kind,
+			"tenantID":   drift.TenantID,
+			"orderID":    drift.OrderID,
+			"stream":     drift.Stream,
+			"repository": drift.Repository,
+		}).Warn("order drift")
+	}
+	log.WithFields(log.Fields{
+		"target":  *to,
+		"orders":  report.Orders,
+		"matched": report.Matched,
+		"drifts":  len(report.Drifts),
+	}).Info("stream history compared")
+	if len(report.Drifts) > 0 {
+		return fmt.Errorf("%s database differs from stream history in %d orders", *to, len(report.Drifts))
+	}
+	return nil
+}